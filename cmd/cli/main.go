@@ -47,8 +47,16 @@ func main() {
 		},
 	}
 
+	schemaCmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema for .qa.yml",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Print(qa.SchemaContent)
+		},
+	}
+
 	initCmd.AddCommand(hookCmd, expectationsCmd)
-	rootCmd.AddCommand(initCmd, readmeCmd)
+	rootCmd.AddCommand(initCmd, readmeCmd, schemaCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
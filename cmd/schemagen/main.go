@@ -0,0 +1,24 @@
+// Command schemagen writes the JSON Schema for .qa.yml that the qa binary
+// embeds. Run it through go generate from the repository root.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/openark-net/qa/pkg/qa/infrastructure/config"
+)
+
+func main() {
+	out := flag.String("o", "qa.schema.json", "output file")
+	flag.Parse()
+
+	schema, err := config.Schema()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*out, schema, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
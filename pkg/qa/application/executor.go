@@ -2,30 +2,75 @@ package application
 
 import (
 	"context"
+	"errors"
 	"log"
+	"runtime"
 	"sync"
+	"time"
 
 	"github.com/openark-net/qa/pkg/qa/domain"
 )
 
 type Executor struct {
-	runner   domain.CommandRunner
-	cache    domain.Cache
-	eventsCh chan domain.Event
+	runner     domain.CommandRunner
+	cache      domain.Cache
+	conditions domain.ConditionEvaluator
+	jobs       int
+	failFast   bool
+	slots      *semaphore
+	locks      *locks
+	eventsCh   chan domain.Event
 }
 
-func New(runner domain.CommandRunner, cache domain.Cache) *Executor {
-	return &Executor{
+type Option func(*Executor)
+
+// WithConditions skips commands whose When rules do not hold.
+func WithConditions(conditions domain.ConditionEvaluator) Option {
+	return func(e *Executor) {
+		e.conditions = conditions
+	}
+}
+
+// WithJobs limits how many job slots running commands may hold at once.
+// Each command holds as many slots as its weight. The default is the
+// number of CPUs.
+func WithJobs(n int) Option {
+	return func(e *Executor) {
+		e.jobs = n
+	}
+}
+
+// WithFailFast cancels running checks and does not start pending ones as
+// soon as one check fails.
+func WithFailFast() Option {
+	return func(e *Executor) {
+		e.failFast = true
+	}
+}
+
+func New(runner domain.CommandRunner, cache domain.Cache, opts ...Option) *Executor {
+	e := &Executor{
 		runner:   runner,
 		cache:    cache,
+		jobs:     runtime.NumCPU(),
+		locks:    newLocks(),
 		eventsCh: make(chan domain.Event, 100),
 	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	e.slots = newSemaphore(max(e.jobs, 1))
+	return e
 }
 
 func (e *Executor) Events() <-chan domain.Event {
 	return e.eventsCh
 }
 
+// Run runs the format commands and then the checks, reporting progress on
+// Events. Cancelling ctx stops running commands and starts no new ones;
+// they are reported as Cancelled and their results are not cached, while
+// checks that finished before still are.
 func (e *Executor) Run(ctx context.Context, cfg domain.ConfigSet) bool {
 	formatSuccess := e.runFormat(ctx, cfg.Format)
 	e.eventsCh <- domain.PhaseCompleted{Phase: domain.PhaseFormat, Success: formatSuccess}
@@ -74,50 +119,199 @@ func (e *Executor) runFormat(ctx context.Context, formatCmds map[string][]domain
 
 func (e *Executor) runSequential(ctx context.Context, cmds []domain.Command) bool {
 	for _, cmd := range cmds {
-		e.eventsCh <- domain.CommandStarted{Command: cmd}
-		result := e.runner.Run(ctx, cmd)
+		if ok, reason := e.shouldRun(cmd); !ok {
+			e.eventsCh <- domain.CommandSkipped{Command: cmd, Reason: reason}
+			continue
+		}
+
+		result := e.run(ctx, cmd, nil)
 		e.eventsCh <- domain.CommandFinished{Result: result}
 
-		if result.State == domain.Failed {
+		if result.State != domain.Completed {
 			return false
 		}
 	}
 	return true
 }
 
+// runChecks runs every check as soon as the checks it needs have
+// succeeded, so independent checks run in parallel. A check whose
+// dependency failed is skipped in turn; a check skipped because its
+// conditions do not hold counts as satisfied for its dependents. In
+// fail-fast mode the first failure cancels every other check.
 func (e *Executor) runChecks(ctx context.Context, checks []domain.Command) bool {
 	if len(checks) == 0 {
 		return true
 	}
 
-	var wg sync.WaitGroup
-	results := make(chan bool, len(checks))
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
 
-	for _, cmd := range checks {
-		if e.cache.Hit(cmd) {
-			e.eventsCh <- domain.CommandCached{Command: cmd}
-			continue
-		}
+	var failed func()
+	if e.failFast {
+		failed = func() { cancel(domain.ErrFailFast) }
+	}
+
+	// Checks get a node each, even when two share a Ref; a need on such a
+	// Ref waits for all of them.
+	nodes := make([]*node, len(checks))
+	byRef := make(map[domain.Ref][]*node, len(checks))
+	for i, cmd := range checks {
+		nodes[i] = &node{done: make(chan struct{})}
+		byRef[cmd.Ref()] = append(byRef[cmd.Ref()], nodes[i])
+	}
+
+	cached := make([]bool, len(checks))
+	for i, cmd := range checks {
+		cached[i] = e.cache.Hit(cmd)
+	}
 
+	var wg sync.WaitGroup
+	for i, cmd := range checks {
 		wg.Add(1)
-		go func(c domain.Command) {
+		go func(i int, c domain.Command) {
 			defer wg.Done()
-			e.eventsCh <- domain.CommandStarted{Command: c}
-			result := e.runner.Run(ctx, c)
+			n := nodes[i]
+			defer close(n.done)
+
+			blocker, ok := waitForNeeds(c, byRef)
+			if ctx.Err() != nil {
+				e.eventsCh <- domain.CommandFinished{Result: cancelled(ctx, c)}
+				return
+			}
+			if !ok {
+				e.eventsCh <- domain.CommandSkipped{Command: c, Reason: "needs " + blocker.Name}
+				return
+			}
+
+			if ok, reason := e.shouldRun(c); !ok {
+				e.eventsCh <- domain.CommandSkipped{Command: c, Reason: reason}
+				n.success = true
+				return
+			}
+
+			if cached[i] {
+				e.eventsCh <- domain.CommandCached{Command: c}
+				n.success = true
+				return
+			}
+
+			result := e.run(ctx, c, failed)
 			e.eventsCh <- domain.CommandFinished{Result: result}
-			success := result.State == domain.Completed
-			e.cache.RecordResult(c, success)
-			results <- success
-		}(cmd)
+			n.success = result.State == domain.Completed
+			if result.State == domain.Cancelled {
+				return
+			}
+			e.cache.RecordResult(c, n.success)
+		}(i, cmd)
 	}
 
 	wg.Wait()
-	close(results)
 
-	for success := range results {
-		if !success {
+	for _, n := range nodes {
+		if !n.success {
 			return false
 		}
 	}
 	return true
 }
+
+// run waits for cmd's locks and then for job slots, reporting it as queued
+// while it waits, and runs it, again up to cmd.Retries times while it
+// fails. Only the output of the last attempt is kept; a command that timed
+// out is not retried. Locks come first so a command waiting for one does
+// not hold slots others could use. A command stopped because ctx was
+// cancelled is Cancelled, not Failed, and one stopped by ctx's deadline is
+// TimedOut. When the command fails, failed, if set, is called before its
+// locks and slots are released, so a fail-fast cancel reaches the commands
+// waiting for them before they can start.
+func (e *Executor) run(ctx context.Context, cmd domain.Command, failed func()) domain.CommandResult {
+	if ctx.Err() != nil {
+		return cancelled(ctx, cmd)
+	}
+
+	lockStart := time.Now()
+	unlock, waited, err := e.locks.acquire(ctx, cmd.Locks, func(name string) {
+		e.eventsCh <- domain.CommandQueued{Command: cmd, Reason: "waiting for lock " + name}
+	})
+	if err != nil {
+		return cancelled(ctx, cmd)
+	}
+	defer unlock()
+
+	var lockWait time.Duration
+	if waited {
+		lockWait = time.Since(lockStart)
+	}
+
+	if !e.slots.tryAcquire(cmd.Weight) {
+		e.eventsCh <- domain.CommandQueued{Command: cmd, Reason: "waiting for a job slot"}
+		if err := e.slots.acquire(ctx, cmd.Weight); err != nil {
+			return cancelled(ctx, cmd)
+		}
+	}
+	defer e.slots.release(cmd.Weight)
+
+	// The slots or locks may have been handed over just as ctx was
+	// cancelled.
+	if ctx.Err() != nil {
+		return cancelled(ctx, cmd)
+	}
+
+	e.eventsCh <- domain.CommandStarted{Command: cmd, LockWait: lockWait}
+	var result domain.CommandResult
+	for attempt := 1; attempt <= cmd.Retries+1; attempt++ {
+		result = e.runner.Run(ctx, cmd)
+		result.Attempts = attempt
+		if result.State != domain.Failed || ctx.Err() != nil {
+			break
+		}
+	}
+	if result.State == domain.Failed && ctx.Err() != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			result.State = domain.TimedOut
+		} else {
+			result.State = domain.Cancelled
+			result.Cause = context.Cause(ctx)
+		}
+	}
+	if failed != nil && (result.State == domain.Failed || result.State == domain.TimedOut) {
+		failed()
+	}
+	return result
+}
+
+// cancelled is the result of cmd when ctx was cancelled before it could
+// start.
+func cancelled(ctx context.Context, cmd domain.Command) domain.CommandResult {
+	return domain.CommandResult{Command: cmd, State: domain.Cancelled, Cause: context.Cause(ctx)}
+}
+
+func (e *Executor) shouldRun(cmd domain.Command) (bool, string) {
+	if e.conditions == nil || cmd.When.IsZero() {
+		return true, ""
+	}
+	return e.conditions.Evaluate(cmd)
+}
+
+// node tracks one check while the dependency graph runs. success is only
+// read after done is closed.
+type node struct {
+	done    chan struct{}
+	success bool
+}
+
+// waitForNeeds blocks until every check c needs has finished. It returns
+// the first one that did not succeed. Needs outside the running set, such
+// as checks removed by filtering, are treated as satisfied.
+func waitForNeeds(c domain.Command, byRef map[domain.Ref][]*node) (domain.Ref, bool) {
+	for _, ref := range c.Needs {
+		for _, dep := range byRef[ref] {
+			<-dep.done
+			if !dep.success {
+				return ref, false
+			}
+		}
+	}
+	return domain.Ref{}, true
+}
@@ -0,0 +1,550 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openark-net/qa/pkg/qa/domain"
+)
+
+type fakeRunner struct {
+	mu      sync.Mutex
+	started map[string]time.Time
+	ended   map[string]time.Time
+	fail    map[string]bool
+	delay   time.Duration
+}
+
+func newFakeRunner(fail ...string) *fakeRunner {
+	r := &fakeRunner{
+		started: make(map[string]time.Time),
+		ended:   make(map[string]time.Time),
+		fail:    make(map[string]bool),
+		delay:   20 * time.Millisecond,
+	}
+	for _, cmd := range fail {
+		r.fail[cmd] = true
+	}
+	return r
+}
+
+func (r *fakeRunner) Run(ctx context.Context, cmd domain.Command) domain.CommandResult {
+	r.mu.Lock()
+	r.started[cmd.Cmd] = time.Now()
+	r.mu.Unlock()
+
+	time.Sleep(r.delay)
+
+	r.mu.Lock()
+	r.ended[cmd.Cmd] = time.Now()
+	r.mu.Unlock()
+
+	if r.fail[cmd.Cmd] {
+		return domain.CommandResult{Command: cmd, State: domain.Failed, ExitCode: 1}
+	}
+	return domain.CommandResult{Command: cmd, State: domain.Completed}
+}
+
+type noCache struct{}
+
+func (noCache) Hit(domain.Command) bool           { return false }
+func (noCache) RecordResult(domain.Command, bool) {}
+func (noCache) Flush() error                      { return nil }
+
+type skipAll struct{ reason string }
+
+func (s skipAll) Evaluate(domain.Command) (bool, string) { return false, s.reason }
+
+// recordingCache remembers which commands had their result recorded.
+type recordingCache struct {
+	noCache
+	mu       sync.Mutex
+	recorded map[string]bool
+}
+
+func (c *recordingCache) RecordResult(cmd domain.Command, success bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.recorded == nil {
+		c.recorded = make(map[string]bool)
+	}
+	c.recorded[cmd.Cmd] = success
+}
+
+// blockingRunner fails the commands in fail at once and blocks every other
+// command until ctx is cancelled.
+type blockingRunner struct {
+	mu      sync.Mutex
+	started []string
+	fail    map[string]bool
+}
+
+func (r *blockingRunner) Run(ctx context.Context, cmd domain.Command) domain.CommandResult {
+	r.mu.Lock()
+	r.started = append(r.started, cmd.Cmd)
+	r.mu.Unlock()
+
+	if r.fail[cmd.Cmd] {
+		return domain.CommandResult{Command: cmd, State: domain.Failed, ExitCode: 1}
+	}
+	<-ctx.Done()
+	return domain.CommandResult{Command: cmd, State: domain.Failed, ExitCode: -1}
+}
+
+func run(t *testing.T, r domain.CommandRunner, cfg domain.ConfigSet, opts ...Option) (bool, []domain.Event) {
+	t.Helper()
+	return runIn(t, context.Background(), r, noCache{}, cfg, opts...)
+}
+
+func runIn(t *testing.T, ctx context.Context, r domain.CommandRunner, cache domain.Cache, cfg domain.ConfigSet, opts ...Option) (bool, []domain.Event) {
+	t.Helper()
+	exec := New(r, cache, opts...)
+
+	var events []domain.Event
+	done := make(chan struct{})
+	go func() {
+		for e := range exec.Events() {
+			events = append(events, e)
+		}
+		close(done)
+	}()
+
+	success := exec.Run(ctx, cfg)
+	<-done
+	return success, events
+}
+
+func TestExecutor_NeedsOrdersChecks(t *testing.T) {
+	r := newFakeRunner()
+	cfg := domain.ConfigSet{
+		Checks: []domain.Command{
+			{Cmd: "npm test", WorkingDir: "web", Needs: []domain.Ref{{WorkingDir: "web", Name: "build"}}},
+			{Name: "build", Cmd: "npm run build", WorkingDir: "web"},
+			{Cmd: "go test", WorkingDir: "api"},
+		},
+	}
+
+	success, _ := run(t, r, cfg, WithJobs(3))
+	if !success {
+		t.Fatal("expected success")
+	}
+
+	if r.started["npm test"].Before(r.ended["npm run build"]) {
+		t.Error("npm test started before npm run build finished")
+	}
+	if r.started["go test"].After(r.ended["npm run build"]) {
+		t.Error("independent check waited for unrelated dependency")
+	}
+}
+
+func TestExecutor_SkipsDependentsOfFailedCheck(t *testing.T) {
+	r := newFakeRunner("npm run build")
+	cfg := domain.ConfigSet{
+		Checks: []domain.Command{
+			{Name: "build", Cmd: "npm run build", WorkingDir: "web"},
+			{Name: "test", Cmd: "npm test", WorkingDir: "web", Needs: []domain.Ref{{WorkingDir: "web", Name: "build"}}},
+			{Cmd: "npm run e2e", WorkingDir: "web", Needs: []domain.Ref{{WorkingDir: "web", Name: "test"}}},
+		},
+	}
+
+	success, events := run(t, r, cfg)
+	if success {
+		t.Fatal("expected failure")
+	}
+
+	skipped := make(map[string]string)
+	for _, e := range events {
+		if s, ok := e.(domain.CommandSkipped); ok {
+			skipped[s.Command.Cmd] = s.Reason
+		}
+	}
+
+	if len(skipped) != 2 {
+		t.Fatalf("expected 2 skipped checks, got %v", skipped)
+	}
+	if skipped["npm test"] != "needs build" {
+		t.Errorf("unexpected reason for npm test: %q", skipped["npm test"])
+	}
+	if _, ran := r.started["npm test"]; ran {
+		t.Error("dependent of failed check was run")
+	}
+}
+
+func TestExecutor_ChecksSharingARef(t *testing.T) {
+	r := newFakeRunner()
+	cfg := domain.ConfigSet{
+		Checks: []domain.Command{
+			{Cmd: "true", WorkingDir: "."},
+			{Cmd: "true", WorkingDir: "."},
+			{Cmd: "make", WorkingDir: ".", Needs: []domain.Ref{{WorkingDir: ".", Name: "true"}}},
+		},
+	}
+
+	success, events := run(t, r, cfg, WithJobs(3))
+	if !success {
+		t.Fatal("expected success")
+	}
+
+	finished := 0
+	for _, e := range events {
+		if _, ok := e.(domain.CommandFinished); ok {
+			finished++
+		}
+	}
+	if finished != 3 {
+		t.Errorf("expected 3 finished checks, got %d", finished)
+	}
+}
+
+func TestExecutor_SkipsChecksWhoseConditionsFail(t *testing.T) {
+	r := newFakeRunner()
+	cfg := domain.ConfigSet{
+		Format: map[string][]domain.Command{
+			"infra": {{Cmd: "terraform fmt", WorkingDir: "infra", When: domain.Condition{Changed: []string{"**/*.tf"}}}},
+		},
+		Checks: []domain.Command{
+			{Name: "validate", Cmd: "terraform validate", WorkingDir: "infra", When: domain.Condition{Changed: []string{"**/*.tf"}}},
+			{Cmd: "tflint", WorkingDir: "infra", Needs: []domain.Ref{{WorkingDir: "infra", Name: "validate"}}},
+			{Cmd: "go test", WorkingDir: "api"},
+		},
+	}
+
+	success, events := run(t, r, cfg, WithConditions(skipAll{reason: "no staged changes"}))
+	if !success {
+		t.Fatal("expected success when checks are skipped by condition")
+	}
+
+	var skipped []string
+	for _, e := range events {
+		if s, ok := e.(domain.CommandSkipped); ok {
+			skipped = append(skipped, s.Command.Cmd)
+			if s.Reason != "no staged changes" {
+				t.Errorf("unexpected reason %q", s.Reason)
+			}
+		}
+	}
+	if len(skipped) != 2 {
+		t.Errorf("expected terraform fmt and validate to be skipped, got %v", skipped)
+	}
+	if _, ran := r.started["tflint"]; !ran {
+		t.Error("expected dependent of condition-skipped check to run")
+	}
+}
+
+type flakyRunner struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+}
+
+func (r *flakyRunner) Run(ctx context.Context, cmd domain.Command) domain.CommandResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	if r.calls <= r.failures {
+		return domain.CommandResult{Command: cmd, State: domain.Failed, ExitCode: 1}
+	}
+	return domain.CommandResult{Command: cmd, State: domain.Completed}
+}
+
+func TestExecutor_RetriesFailedChecks(t *testing.T) {
+	r := &flakyRunner{failures: 2}
+	cfg := domain.ConfigSet{
+		Checks: []domain.Command{{Cmd: "flaky", WorkingDir: ".", Retries: 2}},
+	}
+
+	success, events := run(t, r, cfg)
+
+	if !success {
+		t.Fatal("expected the check to pass on its third attempt")
+	}
+	for _, e := range events {
+		if finished, ok := e.(domain.CommandFinished); ok && finished.Result.Attempts != 3 {
+			t.Errorf("expected 3 attempts, got %d", finished.Result.Attempts)
+		}
+	}
+}
+
+func TestExecutor_RetriesExhausted(t *testing.T) {
+	r := &flakyRunner{failures: 5}
+	cfg := domain.ConfigSet{
+		Checks: []domain.Command{{Cmd: "flaky", WorkingDir: ".", Retries: 1}},
+	}
+
+	success, _ := run(t, r, cfg)
+
+	if success {
+		t.Error("expected the check to fail")
+	}
+	if r.calls != 2 {
+		t.Errorf("expected 2 attempts, got %d", r.calls)
+	}
+}
+
+func TestExecutor_JobsLimitConcurrency(t *testing.T) {
+	r := newFakeRunner()
+	cfg := domain.ConfigSet{
+		Checks: []domain.Command{
+			{Cmd: "a", WorkingDir: "."},
+			{Cmd: "b", WorkingDir: "."},
+			{Cmd: "c", WorkingDir: "."},
+		},
+	}
+
+	success, events := run(t, r, cfg, WithJobs(1))
+
+	if !success {
+		t.Fatal("expected success")
+	}
+	assertNoOverlap(t, r, "a", "b", "c")
+
+	queued := 0
+	for _, e := range events {
+		if _, ok := e.(domain.CommandQueued); ok {
+			queued++
+		}
+	}
+	if queued != 2 {
+		t.Errorf("expected 2 queued events, got %d", queued)
+	}
+}
+
+func TestExecutor_WeightTakesSlots(t *testing.T) {
+	r := newFakeRunner()
+	cfg := domain.ConfigSet{
+		Checks: []domain.Command{
+			{Cmd: "heavy", WorkingDir: ".", Weight: 3},
+			{Cmd: "light", WorkingDir: "."},
+		},
+	}
+
+	success, _ := run(t, r, cfg, WithJobs(2))
+
+	if !success {
+		t.Fatal("expected success")
+	}
+	assertNoOverlap(t, r, "heavy", "light")
+}
+
+func assertNoOverlap(t *testing.T, r *fakeRunner, cmds ...string) {
+	t.Helper()
+	for i, a := range cmds {
+		for _, b := range cmds[i+1:] {
+			if r.started[a].Before(r.ended[b]) && r.started[b].Before(r.ended[a]) {
+				t.Errorf("%s and %s ran at the same time", a, b)
+			}
+		}
+	}
+}
+
+func TestExecutor_LocksSerializeChecks(t *testing.T) {
+	r := newFakeRunner()
+	cfg := domain.ConfigSet{
+		Checks: []domain.Command{
+			{Cmd: "db-a", WorkingDir: ".", Locks: []string{"postgres"}},
+			{Cmd: "db-b", WorkingDir: ".", Locks: []string{"cache", "postgres"}},
+			{Cmd: "unit", WorkingDir: "."},
+		},
+	}
+
+	success, events := run(t, r, cfg, WithJobs(3))
+
+	if !success {
+		t.Fatal("expected success")
+	}
+	assertNoOverlap(t, r, "db-a", "db-b")
+	if r.started["unit"].After(r.ended["db-a"]) && r.started["unit"].After(r.ended["db-b"]) {
+		t.Error("check without locks waited for locked checks")
+	}
+
+	var waited, queued int
+	for _, e := range events {
+		switch e := e.(type) {
+		case domain.CommandStarted:
+			if e.LockWait > 0 {
+				waited++
+			}
+		case domain.CommandQueued:
+			if e.Reason != "waiting for lock postgres" {
+				t.Errorf("unexpected queued reason %q", e.Reason)
+			}
+			queued++
+		}
+	}
+	if waited != 1 || queued != 1 {
+		t.Errorf("expected one check to wait for the lock, got %d waits and %d queued events", waited, queued)
+	}
+}
+
+func TestExecutor_FailFastCancelsOtherChecks(t *testing.T) {
+	r := &blockingRunner{fail: map[string]bool{"lint": true}}
+	cache := &recordingCache{}
+	cfg := domain.ConfigSet{
+		Checks: []domain.Command{
+			{Cmd: "slow", WorkingDir: "."},
+			{Name: "lint", Cmd: "lint", WorkingDir: "."},
+			{Cmd: "test", WorkingDir: ".", Needs: []domain.Ref{{WorkingDir: ".", Name: "slow"}}},
+		},
+	}
+
+	done := make(chan struct{})
+	var success bool
+	var events []domain.Event
+	go func() {
+		success, events = runIn(t, context.Background(), r, cache, cfg, WithJobs(3), WithFailFast())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fail-fast did not cancel the running check")
+	}
+
+	if success {
+		t.Fatal("expected failure")
+	}
+
+	states := make(map[string]domain.CommandState)
+	for _, e := range events {
+		if f, ok := e.(domain.CommandFinished); ok {
+			states[f.Result.Command.Cmd] = f.Result.State
+		}
+	}
+	want := map[string]domain.CommandState{
+		"lint": domain.Failed,
+		"slow": domain.Cancelled,
+		"test": domain.Cancelled,
+	}
+	for cmd, state := range want {
+		if states[cmd] != state {
+			t.Errorf("%s: expected state %v, got %v", cmd, state, states[cmd])
+		}
+	}
+
+	for _, cmd := range r.started {
+		if cmd == "test" {
+			t.Error("pending check was started after the failure")
+		}
+	}
+	if len(cache.recorded) != 1 || cache.recorded["lint"] {
+		t.Errorf("expected only the failed check to be cached, got %v", cache.recorded)
+	}
+}
+
+func TestExecutor_WithoutFailFastChecksContinue(t *testing.T) {
+	r := newFakeRunner("lint")
+	cfg := domain.ConfigSet{
+		Checks: []domain.Command{
+			{Cmd: "lint", WorkingDir: "."},
+			{Cmd: "test", WorkingDir: "."},
+		},
+	}
+
+	success, _ := run(t, r, cfg, WithJobs(1))
+	if success {
+		t.Fatal("expected failure")
+	}
+	if _, ran := r.started["test"]; !ran {
+		t.Error("check was not run after an unrelated failure")
+	}
+}
+
+func TestExecutor_DeadlineTimesOutRunningChecks(t *testing.T) {
+	r := &blockingRunner{}
+	cache := &recordingCache{}
+	cfg := domain.ConfigSet{
+		Checks: []domain.Command{
+			{Name: "watch", Cmd: "npm test", WorkingDir: "."},
+			{Cmd: "npm run e2e", WorkingDir: ".", Needs: []domain.Ref{{WorkingDir: ".", Name: "watch"}}},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	success, events := runIn(t, ctx, r, cache, cfg, WithJobs(2))
+	if success {
+		t.Fatal("expected failure")
+	}
+
+	states := make(map[string]domain.CommandState)
+	for _, e := range events {
+		if f, ok := e.(domain.CommandFinished); ok {
+			states[f.Result.Command.Cmd] = f.Result.State
+		}
+	}
+	if states["npm test"] != domain.TimedOut {
+		t.Errorf("expected running check to time out, got %v", states["npm test"])
+	}
+	if states["npm run e2e"] != domain.Cancelled {
+		t.Errorf("expected pending check to be cancelled, got %v", states["npm run e2e"])
+	}
+	if success, ok := cache.recorded["npm test"]; !ok || success {
+		t.Errorf("expected timed-out check to be recorded as failed, got %v", cache.recorded)
+	}
+}
+
+func TestExecutor_CancelInterruptsRunningChecks(t *testing.T) {
+	r := &blockingRunner{fail: map[string]bool{}}
+	cache := &recordingCache{}
+	cfg := domain.ConfigSet{
+		Checks: []domain.Command{
+			{Name: "test", Cmd: "go test", WorkingDir: "."},
+			{Cmd: "go build", WorkingDir: ".", Needs: []domain.Ref{{WorkingDir: ".", Name: "test"}}},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	success, events := runIn(t, ctx, r, cache, cfg, WithJobs(2))
+	if success {
+		t.Fatal("expected failure")
+	}
+
+	results := make(map[string]domain.CommandResult)
+	for _, e := range events {
+		if f, ok := e.(domain.CommandFinished); ok {
+			results[f.Result.Command.Cmd] = f.Result
+		}
+	}
+	if got := results["go test"]; got.State != domain.Cancelled || got.Attempts != 1 {
+		t.Errorf("expected running check to be interrupted, got state %v after %d attempts", got.State, got.Attempts)
+	}
+	if got := results["go build"]; got.State != domain.Cancelled || got.Attempts != 0 {
+		t.Errorf("expected pending check to be cancelled without running, got state %v after %d attempts", got.State, got.Attempts)
+	}
+	if len(cache.recorded) != 0 {
+		t.Errorf("expected nothing cached for interrupted checks, got %v", cache.recorded)
+	}
+}
+
+func TestExecutor_FailFastStartsNothingAfterAFailure(t *testing.T) {
+	for range 20 {
+		r := newFakeRunner("lint")
+		r.delay = time.Millisecond
+		cfg := domain.ConfigSet{
+			Checks: []domain.Command{
+				{Cmd: "lint", WorkingDir: "."},
+				{Cmd: "a", WorkingDir: "."},
+				{Cmd: "b", WorkingDir: "."},
+				{Cmd: "c", WorkingDir: "."},
+			},
+		}
+
+		_, events := run(t, r, cfg, WithJobs(1), WithFailFast())
+
+		for cmd, started := range r.started {
+			if cmd != "lint" && started.After(r.ended["lint"]) {
+				t.Fatalf("%s started after lint failed", cmd)
+			}
+		}
+		for _, e := range events {
+			f, ok := e.(domain.CommandFinished)
+			if ok && f.Result.State == domain.Cancelled && !errors.Is(f.Result.Cause, domain.ErrFailFast) {
+				t.Errorf("%s: expected fail-fast as the cause, got %v", f.Result.Command.Cmd, f.Result.Cause)
+			}
+		}
+	}
+}
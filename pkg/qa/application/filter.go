@@ -0,0 +1,59 @@
+package application
+
+import (
+	"slices"
+
+	"github.com/openark-net/qa/pkg/qa/domain"
+)
+
+// FilterByTags keeps the commands that carry at least one tag in include,
+// or every command when include is empty, and drop any carrying a tag in
+// exclude. It returns the filtered set and how many commands were dropped.
+func FilterByTags(cfg domain.ConfigSet, include, exclude []string) (domain.ConfigSet, int) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return cfg, 0
+	}
+
+	keep := func(cmd domain.Command) bool {
+		if len(include) > 0 && !hasAnyTag(cmd, include) {
+			return false
+		}
+		return !hasAnyTag(cmd, exclude)
+	}
+
+	filtered := domain.ConfigSet{
+		Format:   make(map[string][]domain.Command),
+		Overlays: cfg.Overlays,
+		Jobs:     cfg.Jobs,
+	}
+	excluded := 0
+
+	for dir, cmds := range cfg.Format {
+		for _, cmd := range cmds {
+			if !keep(cmd) {
+				excluded++
+				continue
+			}
+			filtered.Format[dir] = append(filtered.Format[dir], cmd)
+		}
+	}
+
+	for _, cmd := range cfg.Checks {
+		if !keep(cmd) {
+			excluded++
+			continue
+		}
+		filtered.Checks = append(filtered.Checks, cmd)
+	}
+
+	return filtered, excluded
+}
+
+func hasAnyTag(cmd domain.Command, tags []string) bool {
+	for _, tag := range tags {
+		if slices.Contains(cmd.Tags, tag) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package application
+
+import (
+	"testing"
+
+	"github.com/openark-net/qa/pkg/qa/domain"
+)
+
+func TestFilterByTags(t *testing.T) {
+	cfg := domain.ConfigSet{
+		Format: map[string][]domain.Command{
+			"api": {{Cmd: "go fmt", WorkingDir: "api", Tags: []string{"lint"}}},
+		},
+		Checks: []domain.Command{
+			{Cmd: "go vet", Tags: []string{"lint"}},
+			{Cmd: "go test", Tags: []string{"unit"}},
+			{Cmd: "go test -tags integration", Tags: []string{"unit", "slow"}},
+			{Cmd: "govulncheck", Tags: []string{"security"}},
+			{Cmd: "untagged"},
+		},
+	}
+
+	cases := []struct {
+		name     string
+		include  []string
+		exclude  []string
+		want     []string
+		excluded int
+	}{
+		{"no filters", nil, nil, []string{"go vet", "go test", "go test -tags integration", "govulncheck", "untagged"}, 0},
+		{"include", []string{"unit"}, nil, []string{"go test", "go test -tags integration"}, 4},
+		{"include and exclude", []string{"unit"}, []string{"slow"}, []string{"go test"}, 5},
+		{"exclude only", nil, []string{"slow", "security"}, []string{"go vet", "go test", "untagged"}, 2},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			filtered, excluded := FilterByTags(cfg, c.include, c.exclude)
+
+			if excluded != c.excluded {
+				t.Errorf("excluded = %d, want %d", excluded, c.excluded)
+			}
+			if len(filtered.Checks) != len(c.want) {
+				t.Fatalf("got %d checks, want %v", len(filtered.Checks), c.want)
+			}
+			for i, cmd := range filtered.Checks {
+				if cmd.Cmd != c.want[i] {
+					t.Errorf("check %d = %q, want %q", i, cmd.Cmd, c.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFilterByTags_KeepsOverlaysAndJobs(t *testing.T) {
+	cfg := domain.ConfigSet{
+		Checks:   []domain.Command{{Cmd: "go test", Tags: []string{"unit"}}},
+		Overlays: []domain.Overlay{{File: ".qa.local.yml", Disabled: []string{"lint"}}},
+		Jobs:     3,
+	}
+
+	filtered, _ := FilterByTags(cfg, []string{"unit"}, nil)
+
+	if len(filtered.Overlays) != 1 || filtered.Overlays[0].File != ".qa.local.yml" {
+		t.Errorf("expected overlays to be kept, got %v", filtered.Overlays)
+	}
+	if filtered.Jobs != 3 {
+		t.Errorf("Jobs = %d, want 3", filtered.Jobs)
+	}
+}
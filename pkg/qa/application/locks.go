@@ -0,0 +1,67 @@
+package application
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// locks serializes commands that share a named lock. Each lock is a
+// channel with room for one holder, so waiting can be cancelled.
+type locks struct {
+	mu     sync.Mutex
+	byName map[string]chan struct{}
+}
+
+func newLocks() *locks {
+	return &locks{byName: make(map[string]chan struct{})}
+}
+
+func (l *locks) get(name string) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ch, ok := l.byName[name]
+	if !ok {
+		ch = make(chan struct{}, 1)
+		l.byName[name] = ch
+	}
+	return ch
+}
+
+// acquire takes every named lock, in sorted order so two commands can
+// never each hold a lock the other is waiting for. wait is called before
+// blocking on a lock another command holds. It reports whether it had to
+// wait at all, and returns a function that releases the locks.
+func (l *locks) acquire(ctx context.Context, names []string, wait func(name string)) (release func(), waited bool, err error) {
+	sorted := slices.Clone(names)
+	slices.Sort(sorted)
+	sorted = slices.Compact(sorted)
+
+	var held []chan struct{}
+	release = func() {
+		for _, ch := range held {
+			<-ch
+		}
+	}
+
+	for _, name := range sorted {
+		ch := l.get(name)
+		select {
+		case ch <- struct{}{}:
+			held = append(held, ch)
+			continue
+		default:
+		}
+
+		wait(name)
+		waited = true
+		select {
+		case ch <- struct{}{}:
+			held = append(held, ch)
+		case <-ctx.Done():
+			release()
+			return func() {}, waited, ctx.Err()
+		}
+	}
+	return release, waited, nil
+}
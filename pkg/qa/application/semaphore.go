@@ -0,0 +1,105 @@
+package application
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// semaphore limits how many job slots running commands hold at once.
+// Waiters are served in order, so a heavy command is not starved by a
+// stream of light ones.
+type semaphore struct {
+	mu      sync.Mutex
+	size    int
+	cur     int
+	waiters list.List
+}
+
+type waiter struct {
+	n     int
+	ready chan struct{}
+}
+
+func newSemaphore(size int) *semaphore {
+	return &semaphore{size: size}
+}
+
+// clamp limits a weight to the semaphore's size, so a command heavier than
+// the whole pool still runs, alone.
+func (s *semaphore) clamp(n int) int {
+	return min(max(n, 1), s.size)
+}
+
+// tryAcquire takes n slots if they are free and nobody is waiting.
+func (s *semaphore) tryAcquire(n int) bool {
+	n = s.clamp(n)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.cur += n
+		return true
+	}
+	return false
+}
+
+// acquire blocks until n slots are free or ctx is done.
+func (s *semaphore) acquire(ctx context.Context, n int) error {
+	if s.tryAcquire(n) {
+		return nil
+	}
+	n = s.clamp(n)
+
+	s.mu.Lock()
+	w := waiter{n: n, ready: make(chan struct{})}
+	elem := s.waiters.PushBack(w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-w.ready:
+			// Acquired just as ctx was cancelled; hand the slots back.
+			s.cur -= n
+			s.notify()
+		default:
+			isFront := s.waiters.Front() == elem
+			s.waiters.Remove(elem)
+			if isFront {
+				s.notify()
+			}
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// release returns n slots taken by acquire or tryAcquire.
+func (s *semaphore) release(n int) {
+	n = s.clamp(n)
+	s.mu.Lock()
+	s.cur -= n
+	s.notify()
+	s.mu.Unlock()
+}
+
+// notify wakes waiters from the front of the queue while their slots are
+// free. It must be called with mu held.
+func (s *semaphore) notify() {
+	for {
+		front := s.waiters.Front()
+		if front == nil {
+			return
+		}
+		w := front.Value.(waiter)
+		if s.size-s.cur < w.n {
+			return
+		}
+		s.cur += w.n
+		s.waiters.Remove(front)
+		close(w.ready)
+	}
+}
@@ -1,14 +1,163 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
 
 type Command struct {
+	Name       string
 	Cmd        string
 	WorkingDir string
+	Env        map[string]string
+	Timeout    time.Duration
+	// Shell is the program and arguments the command is passed to with -c.
+	// Empty means sh.
+	Shell string
+	// Retries is how many more times a failed command is run before it
+	// counts as failed.
+	Retries int
+	// Weight is how many job slots the command occupies while it runs.
+	// Zero means one.
+	Weight int
+	// Locks names resources the command needs exclusive use of; commands
+	// sharing a lock never run at the same time.
+	Locks  []string
+	Inputs Inputs
+	// ExternalInputs are repository-relative paths or globs outside
+	// WorkingDir that the command also depends on.
+	ExternalInputs []string
+	// Needs lists checks that must succeed before this one starts.
+	Needs []Ref
+	When  Condition
+	Tags  []string
+	// Variant holds the matrix values this command was expanded with. They
+	// are also part of Env.
+	Variant map[string]string
+	Origin  Origin
+}
+
+// Condition restricts when a command runs. Every rule that is set must
+// hold: Changed globs are relative to the working directory and matched
+// against staged changes, Env values must match exactly and Branch globs
+// are matched against the current branch.
+type Condition struct {
+	Changed []string
+	Env     map[string]string
+	Branch  []string
+}
+
+func (c Condition) IsZero() bool {
+	return len(c.Changed) == 0 && len(c.Env) == 0 && len(c.Branch) == 0
+}
+
+// Origin records where a command was defined: the config file and line,
+// and the chain of files that included it, outermost first. Commands from
+// a built-in preset point at the line naming the preset.
+type Origin struct {
+	File   string
+	Line   int
+	Column int
+	Via    []string
+	Preset string
+}
+
+func (o Origin) String() string {
+	if o.File == "" {
+		return ""
+	}
+	if o.Preset != "" {
+		return fmt.Sprintf("%s:%d (preset %s)", o.File, o.Line, o.Preset)
+	}
+	return fmt.Sprintf("%s:%d", o.File, o.Line)
+}
+
+// Ref identifies a command by its working directory and display name.
+type Ref struct {
+	WorkingDir string
+	Name       string
+}
+
+func (r Ref) String() string {
+	return r.WorkingDir + ":" + r.Name
+}
+
+// Inputs narrows the files a check depends on to globs relative to its
+// working directory. An empty Include means every file in the directory.
+type Inputs struct {
+	Include []string
+	Exclude []string
+}
+
+func (i Inputs) IsZero() bool {
+	return len(i.Include) == 0 && len(i.Exclude) == 0
 }
 
 func (c Command) ID() string {
-	return c.WorkingDir + ":" + c.Cmd
+	return c.WorkingDir + ":" + c.Key()
+}
+
+// Key identifies the command within its working directory: the command
+// string, qualified by the matrix variant when there is one, and by a
+// fingerprint of its name, env, shell and timeout when any is set. Two
+// checks running the same command differently never share a cache entry.
+func (c Command) Key() string {
+	key := c.Cmd + c.variantSuffix()
+	if c.Name == "" && len(c.Env) == 0 && c.Shell == "" && c.Timeout == 0 {
+		return key
+	}
+	return key + " #" + c.fingerprint()
+}
+
+func (c Command) fingerprint() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "name=%s\x00shell=%s\x00timeout=%s\x00", c.Name, c.Shell, c.Timeout)
+	keys := make([]string, 0, len(c.Env))
+	for k := range c.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%s\x00", k, c.Env[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// DisplayName is the label shown to users: the configured name when set,
+// otherwise the raw command string, qualified by the matrix variant.
+func (c Command) DisplayName() string {
+	if c.Name != "" {
+		return c.Name + c.variantSuffix()
+	}
+	return c.Cmd + c.variantSuffix()
+}
+
+func (c Command) variantSuffix() string {
+	if len(c.Variant) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(c.Variant))
+	for k := range c.Variant {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + c.Variant[k]
+	}
+	return " (" + strings.Join(pairs, ", ") + ")"
+}
+
+func (c Command) Ref() Ref {
+	return Ref{WorkingDir: c.WorkingDir, Name: c.DisplayName()}
 }
 
 type CommandState int
@@ -16,6 +165,12 @@ type CommandState int
 const (
 	Completed CommandState = iota
 	Failed
+	// Cancelled means the command was stopped, or never started, because
+	// the run was cancelled. It says nothing about the code it checks.
+	Cancelled
+	// TimedOut means the command ran past its own timeout or the run's, and
+	// was stopped. Output holds what it printed until then.
+	TimedOut
 )
 
 type Phase int
@@ -30,11 +185,36 @@ type CommandResult struct {
 	State    CommandState
 	Output   string
 	ExitCode int
+	// Attempts is how many times the command ran, more than one only when
+	// it was retried.
+	Attempts int
+	// Cause says why a Cancelled command was stopped or never started:
+	// ErrFailFast when another check failed, otherwise the run's context
+	// error, such as on Ctrl-C.
+	Cause error
 }
 
+// ErrFailFast is the Cause of commands cancelled because another check
+// failed in fail-fast mode.
+var ErrFailFast = errors.New("another check failed")
+
 type ConfigSet struct {
-	Format map[string][]Command
-	Checks []Command
+	Format   map[string][]Command
+	Checks   []Command
+	Overlays []Overlay
+	// Jobs is the number of job slots a local overlay asked for, or zero.
+	Jobs int
+}
+
+// Overlay records what an uncommitted local config file changed, so that
+// differences between machines are easy to spot.
+type Overlay struct {
+	File     string
+	Added    []string
+	Replaced []string
+	Patched  []string
+	Disabled []string
+	Jobs     int
 }
 
 type ConfigLoader interface {
@@ -45,6 +225,12 @@ type CommandRunner interface {
 	Run(ctx context.Context, cmd Command) CommandResult
 }
 
+// ConditionEvaluator decides whether a command's When rules hold. When
+// they do not, reason explains which rule failed.
+type ConditionEvaluator interface {
+	Evaluate(cmd Command) (ok bool, reason string)
+}
+
 type Cache interface {
 	Hit(cmd Command) bool
 	RecordResult(cmd Command, success bool)
@@ -55,8 +241,21 @@ type Event interface {
 	sealed()
 }
 
-type CommandStarted struct {
+// CommandQueued reports a command that is ready to run but waiting for a
+// lock or free job slots, and which. CommandStarted follows once it has
+// them.
+type CommandQueued struct {
 	Command Command
+	Reason  string
+}
+
+func (CommandQueued) sealed() {}
+
+// CommandStarted reports a command that began running. LockWait is how
+// long it waited for locks other commands held.
+type CommandStarted struct {
+	Command  Command
+	LockWait time.Duration
 }
 
 func (CommandStarted) sealed() {}
@@ -73,6 +272,14 @@ type CommandCached struct {
 
 func (CommandCached) sealed() {}
 
+// CommandSkipped reports a command that was not run, and why.
+type CommandSkipped struct {
+	Command Command
+	Reason  string
+}
+
+func (CommandSkipped) sealed() {}
+
 type PhaseCompleted struct {
 	Phase   Phase
 	Success bool
@@ -3,7 +3,6 @@ package cache
 import (
 	"context"
 	"path/filepath"
-	"strings"
 	"sync"
 	"time"
 
@@ -20,11 +19,19 @@ type Cache struct {
 	repoRoot string
 	data     map[string]Entry
 	mu       sync.Mutex
-	results  map[string]bool
+	results  map[string]result
 }
 
-func New(ctx context.Context, cacheDir string) (*Cache, error) {
-	git, err := NewGitClient(ctx)
+type result struct {
+	relPath string
+	cmd     domain.Command
+	passed  bool
+}
+
+// New returns a cache for the repository containing dir, stored under
+// cacheDir.
+func New(ctx context.Context, cacheDir, dir string) (*Cache, error) {
+	git, err := NewGitClient(ctx, dir)
 	if err != nil {
 		return nil, err
 	}
@@ -44,7 +51,7 @@ func New(ctx context.Context, cacheDir string) (*Cache, error) {
 		cacheDir: cacheDir,
 		repoRoot: git.RepoRoot(),
 		data:     pruned,
-		results:  make(map[string]bool),
+		results:  make(map[string]result),
 	}, nil
 }
 
@@ -69,17 +76,17 @@ func (c *Cache) Hit(cmd domain.Command) bool {
 		return false
 	}
 
-	dirty, err := c.git.IsDirty(c.ctx, relPath)
+	dirty, err := c.dirty(relPath, cmd)
 	if err != nil || dirty {
 		return false
 	}
 
-	hash, err := c.git.TreeHash(c.ctx, relPath)
+	hash, err := c.hash(relPath, cmd)
 	if err != nil {
 		return false
 	}
 
-	key := cacheKey(relPath, cmd.Cmd)
+	key := cacheKey(relPath, cmd.Key())
 	entry, exists := c.data[key]
 	if !exists {
 		return false
@@ -94,9 +101,9 @@ func (c *Cache) RecordResult(cmd domain.Command, success bool) {
 		return
 	}
 
-	key := cacheKey(relPath, cmd.Cmd)
+	key := cacheKey(relPath, cmd.Key())
 	c.mu.Lock()
-	c.results[key] = success
+	c.results[key] = result{relPath: relPath, cmd: cmd, passed: success}
 	c.mu.Unlock()
 }
 
@@ -106,15 +113,12 @@ func (c *Cache) Flush() error {
 
 	now := time.Now()
 
-	for key, passed := range c.results {
-		if !passed {
+	for key, r := range c.results {
+		if !r.passed {
 			continue
 		}
 
-		parts := strings.SplitN(key, "::", 2)
-		path := parts[0]
-
-		hash, err := c.git.TreeHash(c.ctx, path)
+		hash, err := c.hash(r.relPath, r.cmd)
 		if err != nil {
 			continue
 		}
@@ -128,6 +132,44 @@ func (c *Cache) Flush() error {
 	return c.storage.Save(c.cacheDir, c.repoRoot, c.data)
 }
 
+// dirty reports whether cmd's inputs have unstaged changes. Without
+// declared inputs that is any change under relPath.
+func (c *Cache) dirty(relPath string, cmd domain.Command) (bool, error) {
+	var dirty bool
+	var err error
+	if cmd.Inputs.IsZero() {
+		dirty, err = c.git.IsDirty(c.ctx, relPath)
+	} else {
+		dirty, err = c.inputsDirty(relPath, cmd.Inputs)
+	}
+	if err != nil || dirty || len(cmd.ExternalInputs) == 0 {
+		return dirty, err
+	}
+	return c.externalDirty(cmd.ExternalInputs)
+}
+
+// hash identifies the staged content cmd depends on. Without declared
+// inputs that is the tree hash of relPath, extended with the content of any
+// external inputs.
+func (c *Cache) hash(relPath string, cmd domain.Command) (string, error) {
+	var hash string
+	var err error
+	if cmd.Inputs.IsZero() {
+		hash, err = c.git.TreeHash(c.ctx, relPath)
+	} else {
+		hash, err = c.inputHash(relPath, cmd.Inputs)
+	}
+	if err != nil || len(cmd.ExternalInputs) == 0 {
+		return hash, err
+	}
+
+	external, err := c.externalHash(cmd.ExternalInputs)
+	if err != nil {
+		return "", err
+	}
+	return combine(hash, external), nil
+}
+
 func prune(data map[string]Entry, now time.Time, maxAge time.Duration) map[string]Entry {
 	result := make(map[string]Entry, len(data))
 	cutoff := now.Add(-maxAge)
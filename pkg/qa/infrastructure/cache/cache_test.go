@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/openark-net/qa/pkg/qa/domain"
+)
+
+// gitRepo creates a repository with one staged file and returns its path.
+func gitRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"init", "-q"}, {"add", "main.go"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	return dir
+}
+
+func TestCache_SameCommandWithDifferentEnv(t *testing.T) {
+	repo := gitRepo(t)
+	cacheDir := t.TempDir()
+	ctx := context.Background()
+
+	plain := domain.Command{Cmd: "go test ./...", WorkingDir: repo}
+	race := domain.Command{Name: "race", Cmd: "go test ./...", WorkingDir: repo, Env: map[string]string{"GOFLAGS": "-race"}}
+
+	c, err := New(ctx, cacheDir, repo)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.RecordResult(plain, true)
+	c.RecordResult(race, false)
+	if err := c.Flush(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c, err = New(ctx, cacheDir, repo)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !c.Hit(plain) {
+		t.Error("expected the passing check to be cached")
+	}
+	if c.Hit(race) {
+		t.Error("failing check with a different env shared the passing check's cache entry")
+	}
+}
@@ -16,8 +16,10 @@ type GitClient struct {
 	repoRoot string
 }
 
-func NewGitClient(ctx context.Context) (*GitClient, error) {
+// NewGitClient returns a client for the repository containing dir.
+func NewGitClient(ctx context.Context, dir string) (*GitClient, error) {
 	cmd := exec.CommandContext(ctx, "git", "rev-parse", "--show-toplevel")
+	cmd.Dir = dir
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
@@ -109,3 +111,104 @@ func (g *GitClient) ToRelative(absolutePath string) (string, error) {
 	}
 	return rel, nil
 }
+
+// IndexEntry is a file staged in the git index.
+type IndexEntry struct {
+	Path   string
+	Mode   string
+	Object string
+}
+
+// IndexEntries lists the index entries under relativePath, with paths
+// relative to the repository root.
+func (g *GitClient) IndexEntries(ctx context.Context, relativePath string) ([]IndexEntry, error) {
+	out, err := g.output(ctx, "ls-files", "--stage", "-z", "--", relativePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []IndexEntry
+	for _, record := range splitNul(out) {
+		meta, path, ok := strings.Cut(record, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) < 2 {
+			continue
+		}
+		entries = append(entries, IndexEntry{Path: path, Mode: fields[0], Object: fields[1]})
+	}
+	return entries, nil
+}
+
+// IgnoredPaths lists the untracked files and directories git ignores, with
+// paths relative to the repository root. Directories end in a slash and
+// their contents are not listed.
+func (g *GitClient) IgnoredPaths(ctx context.Context) ([]string, error) {
+	out, err := g.output(ctx, "ls-files", "-z", "--others", "--ignored", "--exclude-standard", "--directory")
+	if err != nil {
+		return nil, err
+	}
+	return splitNul(out), nil
+}
+
+// DirtyFiles lists files under relativePath with unstaged changes, with
+// paths relative to the repository root.
+func (g *GitClient) DirtyFiles(ctx context.Context, relativePath string) ([]string, error) {
+	out, err := g.output(ctx, "diff", "--name-only", "-z", "--", relativePath)
+	if err != nil {
+		return nil, err
+	}
+	return splitNul(out), nil
+}
+
+func (g *GitClient) output(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = g.repoRoot
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+func splitNul(s string) []string {
+	var parts []string
+	for _, part := range strings.Split(s, "\x00") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// StagedFiles lists files whose staged content differs from HEAD, with
+// paths relative to the repository root. Before the first commit every
+// staged file is listed.
+func (g *GitClient) StagedFiles(ctx context.Context) ([]string, error) {
+	out, err := g.output(ctx, "diff", "--cached", "--name-only", "-z")
+	if err != nil {
+		return nil, err
+	}
+	return splitNul(out), nil
+}
+
+// Branch returns the name of the checked-out branch, or HEAD when detached.
+func (g *GitClient) Branch(ctx context.Context) (string, error) {
+	out, err := g.output(ctx, "symbolic-ref", "--short", "-q", "HEAD")
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "HEAD", nil
+	}
+	return strings.TrimSpace(out), nil
+}
@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"strings"
+
+	"github.com/openark-net/qa/pkg/qa/domain"
+	"github.com/openark-net/qa/pkg/qa/infrastructure/glob"
+)
+
+// inputHash hashes the index entries under relPath selected by inputs, so
+// edits to files outside the declared inputs leave the hash unchanged.
+func (c *Cache) inputHash(relPath string, inputs domain.Inputs) (string, error) {
+	entries, err := c.git.IndexEntries(c.ctx, relPath)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	for _, e := range entries {
+		if matchesInputs(relPath, e.Path, inputs) {
+			h.Write([]byte(e.Mode + " " + e.Object + " " + e.Path + "\x00"))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// inputsDirty reports whether any file selected by inputs has unstaged
+// changes.
+func (c *Cache) inputsDirty(relPath string, inputs domain.Inputs) (bool, error) {
+	files, err := c.git.DirtyFiles(c.ctx, relPath)
+	if err != nil {
+		return false, err
+	}
+
+	for _, f := range files {
+		if matchesInputs(relPath, f, inputs) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchesInputs reports whether the repo-relative file is selected by
+// inputs, whose globs are relative to relPath.
+func matchesInputs(relPath, file string, inputs domain.Inputs) bool {
+	if relPath != "." {
+		file = strings.TrimPrefix(file, relPath+"/")
+	}
+
+	included := len(inputs.Include) == 0
+	for _, pattern := range inputs.Include {
+		if glob.Match(pattern, file) {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+
+	for _, pattern := range inputs.Exclude {
+		if glob.Match(pattern, file) {
+			return false
+		}
+	}
+	return true
+}
+
+// externalHash hashes the index entries selected by repository-relative
+// paths or globs. Paths that match nothing contribute nothing, so creating
+// them later changes the hash.
+func (c *Cache) externalHash(patterns []string) (string, error) {
+	h := sha256.New()
+	for _, pattern := range patterns {
+		entries, err := c.git.IndexEntries(c.ctx, glob.Base(pattern))
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte(pattern + "\x00"))
+		for _, e := range entries {
+			if matchesExternal(pattern, e.Path) {
+				h.Write([]byte(e.Mode + " " + e.Object + " " + e.Path + "\x00"))
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// externalDirty reports whether any file selected by the repository-relative
+// paths or globs has unstaged changes.
+func (c *Cache) externalDirty(patterns []string) (bool, error) {
+	for _, pattern := range patterns {
+		files, err := c.git.DirtyFiles(c.ctx, glob.Base(pattern))
+		if err != nil {
+			return false, err
+		}
+		for _, f := range files {
+			if matchesExternal(pattern, f) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// matchesExternal reports whether file is selected by pattern. A pattern
+// without metacharacters names a file or a directory and everything in it.
+func matchesExternal(pattern, file string) bool {
+	if glob.HasMeta(pattern) {
+		return glob.Match(pattern, file)
+	}
+	base := path.Clean(pattern)
+	return base == "." || file == base || strings.HasPrefix(file, base+"/")
+}
+
+func combine(hashes ...string) string {
+	h := sha256.New()
+	for _, hash := range hashes {
+		h.Write([]byte(hash + "\x00"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/openark-net/qa/pkg/qa/domain"
+)
+
+func TestMatchesInputs(t *testing.T) {
+	inputs := domain.Inputs{
+		Include: []string{"**/*.go", "go.mod"},
+		Exclude: []string{"**/*_test.go"},
+	}
+
+	cases := []struct {
+		relPath string
+		file    string
+		want    bool
+	}{
+		{"api", "api/main.go", true},
+		{"api", "api/internal/handler.go", true},
+		{"api", "api/go.mod", true},
+		{"api", "api/README.md", false},
+		{"api", "api/handler_test.go", false},
+		{".", "main.go", true},
+		{".", "docs/index.md", false},
+	}
+
+	for _, c := range cases {
+		if got := matchesInputs(c.relPath, c.file, inputs); got != c.want {
+			t.Errorf("matchesInputs(%q, %q) = %v, want %v", c.relPath, c.file, got, c.want)
+		}
+	}
+}
+
+func TestMatchesInputs_ExcludeOnly(t *testing.T) {
+	inputs := domain.Inputs{Exclude: []string{"**/*.md"}}
+
+	if !matchesInputs("web", "web/src/app.ts", inputs) {
+		t.Error("expected non-excluded file to match")
+	}
+	if matchesInputs("web", "web/docs/guide.md", inputs) {
+		t.Error("expected excluded file not to match")
+	}
+}
+
+func TestMatchesExternal(t *testing.T) {
+	cases := []struct {
+		pattern string
+		file    string
+		want    bool
+	}{
+		{"proto", "proto/user.proto", true},
+		{"proto", "protocol/readme.md", false},
+		{"package-lock.json", "package-lock.json", true},
+		{"package-lock.json", "web/package-lock.json", false},
+		{"proto/**/*.proto", "proto/v1/user.proto", true},
+		{"proto/**/*.proto", "proto/v1/README.md", false},
+	}
+
+	for _, c := range cases {
+		if got := matchesExternal(c.pattern, c.file); got != c.want {
+			t.Errorf("matchesExternal(%q, %q) = %v, want %v", c.pattern, c.file, got, c.want)
+		}
+	}
+}
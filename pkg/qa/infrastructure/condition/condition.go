@@ -0,0 +1,139 @@
+package condition
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/openark-net/qa/pkg/qa/domain"
+	"github.com/openark-net/qa/pkg/qa/infrastructure/glob"
+)
+
+// Git is the repository state conditions are evaluated against.
+type Git interface {
+	StagedFiles(ctx context.Context) ([]string, error)
+	Branch(ctx context.Context) (string, error)
+	ToRelative(absolutePath string) (string, error)
+}
+
+// Evaluator checks domain.Condition rules against the environment and the
+// repository. Repository state is read once, on first use. Without a
+// repository, changed and branch rules cannot be decided and are treated
+// as satisfied so the command still runs.
+type Evaluator struct {
+	ctx       context.Context
+	git       Git
+	lookupEnv func(string) (string, bool)
+
+	once   sync.Once
+	staged []string
+	branch string
+	err    error
+}
+
+func New(ctx context.Context, git Git) *Evaluator {
+	return &Evaluator{
+		ctx:       ctx,
+		git:       git,
+		lookupEnv: os.LookupEnv,
+	}
+}
+
+func (e *Evaluator) Evaluate(cmd domain.Command) (bool, string) {
+	when := cmd.When
+	if when.IsZero() {
+		return true, ""
+	}
+
+	if reason := e.checkEnv(when.Env); reason != "" {
+		return false, reason
+	}
+
+	if len(when.Branch) == 0 && len(when.Changed) == 0 {
+		return true, ""
+	}
+	if !e.loadRepoState() {
+		return true, ""
+	}
+
+	if len(when.Branch) > 0 && !matchesAny(when.Branch, e.branch) {
+		return false, fmt.Sprintf("branch %s does not match %s", e.branch, strings.Join(when.Branch, ", "))
+	}
+
+	if len(when.Changed) > 0 && !e.changed(cmd.WorkingDir, when.Changed) {
+		return false, "no staged changes match " + strings.Join(when.Changed, ", ")
+	}
+
+	return true, ""
+}
+
+func (e *Evaluator) checkEnv(env map[string]string) string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if v, _ := e.lookupEnv(k); v != env[k] {
+			return fmt.Sprintf("%s is not %q", k, env[k])
+		}
+	}
+	return ""
+}
+
+func (e *Evaluator) loadRepoState() bool {
+	e.once.Do(func() {
+		if e.git == nil {
+			e.err = fmt.Errorf("not a git repository")
+			return
+		}
+		e.staged, e.err = e.git.StagedFiles(e.ctx)
+		if e.err != nil {
+			return
+		}
+		e.branch, e.err = e.git.Branch(e.ctx)
+	})
+	return e.err == nil
+}
+
+// changed reports whether a staged file matches one of the globs, which
+// are relative to workingDir.
+func (e *Evaluator) changed(workingDir string, patterns []string) bool {
+	relDir := filepath.Clean(workingDir)
+	if filepath.IsAbs(workingDir) {
+		rel, err := e.git.ToRelative(workingDir)
+		if err != nil {
+			return true
+		}
+		relDir = rel
+	}
+	relDir = filepath.ToSlash(relDir)
+
+	for _, file := range e.staged {
+		if relDir != "." {
+			if !strings.HasPrefix(file, relDir+"/") {
+				continue
+			}
+			file = strings.TrimPrefix(file, relDir+"/")
+		}
+		if matchesAny(patterns, file) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if glob.Match(path.Clean(pattern), name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package condition
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/openark-net/qa/pkg/qa/domain"
+)
+
+type fakeGit struct {
+	staged []string
+	branch string
+	err    error
+}
+
+func (g fakeGit) StagedFiles(context.Context) ([]string, error) { return g.staged, g.err }
+func (g fakeGit) Branch(context.Context) (string, error)        { return g.branch, g.err }
+func (g fakeGit) ToRelative(p string) (string, error)           { return p[len("/repo/"):], nil }
+
+func newEvaluator(git Git, env map[string]string) *Evaluator {
+	e := New(context.Background(), git)
+	e.lookupEnv = func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}
+	return e
+}
+
+func TestEvaluate_Changed(t *testing.T) {
+	e := newEvaluator(fakeGit{staged: []string{"infra/main.tf", "web/app.ts"}, branch: "main"}, nil)
+
+	ok, _ := e.Evaluate(domain.Command{WorkingDir: "/repo/infra", When: domain.Condition{Changed: []string{"**/*.tf"}}})
+	if !ok {
+		t.Error("expected staged .tf change to satisfy condition")
+	}
+
+	ok, reason := e.Evaluate(domain.Command{WorkingDir: "/repo/e2e", When: domain.Condition{Changed: []string{"**"}}})
+	if ok {
+		t.Error("expected no staged changes under e2e")
+	}
+	if reason != "no staged changes match **" {
+		t.Errorf("unexpected reason %q", reason)
+	}
+}
+
+func TestEvaluate_Branch(t *testing.T) {
+	e := newEvaluator(fakeGit{branch: "release/1.2"}, nil)
+
+	if ok, _ := e.Evaluate(domain.Command{When: domain.Condition{Branch: []string{"main", "release/*"}}}); !ok {
+		t.Error("expected release branch to match")
+	}
+
+	ok, reason := e.Evaluate(domain.Command{When: domain.Condition{Branch: []string{"main"}}})
+	if ok {
+		t.Error("expected release branch not to match main")
+	}
+	if reason != "branch release/1.2 does not match main" {
+		t.Errorf("unexpected reason %q", reason)
+	}
+}
+
+func TestEvaluate_Env(t *testing.T) {
+	e := newEvaluator(nil, map[string]string{"CI": "true"})
+
+	if ok, _ := e.Evaluate(domain.Command{When: domain.Condition{Env: map[string]string{"CI": "true"}}}); !ok {
+		t.Error("expected CI=true to match")
+	}
+
+	ok, reason := e.Evaluate(domain.Command{When: domain.Condition{Env: map[string]string{"DEPLOY": "1"}}})
+	if ok {
+		t.Error("expected unset DEPLOY not to match")
+	}
+	if reason != `DEPLOY is not "1"` {
+		t.Errorf("unexpected reason %q", reason)
+	}
+}
+
+func TestEvaluate_WithoutRepositoryRuns(t *testing.T) {
+	e := newEvaluator(fakeGit{err: errors.New("not a git repository")}, nil)
+
+	if ok, _ := e.Evaluate(domain.Command{When: domain.Condition{Changed: []string{"**"}}}); !ok {
+		t.Error("expected changed rule to be satisfied without a repository")
+	}
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"slices"
+	"time"
+)
+
+// defaults are settings for every command of a file and the files it
+// includes. A file's own defaults take precedence over inherited ones
+// field by field, and an entry's own settings take precedence over both.
+type defaults struct {
+	Timeout time.Duration      `yaml:"timeout"`
+	Shell   string             `yaml:"shell"`
+	Env     map[string]located `yaml:"env"`
+	Retries *int               `yaml:"retries"`
+	Tags    []string           `yaml:"tags"`
+}
+
+// scope is what a file passes down to the files it includes.
+type scope struct {
+	env      map[string]string
+	defaults defaults
+}
+
+// merge returns d overlaid with the fields set in own. Env is not merged
+// here; it cascades through scope.env instead.
+func (d defaults) merge(own defaults) defaults {
+	if own.Timeout > 0 {
+		d.Timeout = own.Timeout
+	}
+	if own.Shell != "" {
+		d.Shell = own.Shell
+	}
+	if own.Retries != nil {
+		d.Retries = own.Retries
+	}
+	if own.Tags != nil {
+		d.Tags = own.Tags
+	}
+	d.Env = nil
+	return d
+}
+
+// apply fills in the settings e leaves unset. Default tags are added to
+// the entry's own.
+func (d defaults) apply(e entry) entry {
+	if e.Timeout == 0 {
+		e.Timeout = d.Timeout
+	}
+	if e.Shell == "" {
+		e.Shell = d.Shell
+	}
+	if e.Retries == nil {
+		e.Retries = d.Retries
+	}
+	if len(d.Tags) > 0 {
+		tags := slices.Clone(d.Tags)
+		for _, tag := range e.Tags {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		e.Tags = tags
+	}
+	return e
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLoad_DefaultsCascadeThroughIncludes(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`defaults:
+  timeout: 10m
+  shell: bash -eo pipefail
+  retries: 1
+  tags: [ci]
+  env:
+    CI: "true"
+includes:
+  - api/.qa.yml
+checks:
+  - go vet ./...
+`),
+		},
+		"api/.qa.yml": &fstest.MapFile{
+			Data: []byte(`defaults:
+  retries: 0
+  tags: [api]
+checks:
+  - run: go test ./...
+    timeout: 2m
+    tags: [test]
+`),
+		},
+	}
+
+	cfg, err := New(fsys).Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Checks) != 2 {
+		t.Fatalf("expected 2 checks, got %d", len(cfg.Checks))
+	}
+
+	root := cfg.Checks[0]
+	if root.Timeout != 10*time.Minute || root.Shell != "bash -eo pipefail" || root.Retries != 1 {
+		t.Errorf("expected root defaults, got timeout %v, shell %q, retries %d", root.Timeout, root.Shell, root.Retries)
+	}
+	if !reflect.DeepEqual(root.Tags, []string{"ci"}) || root.Env["CI"] != "true" {
+		t.Errorf("expected default tags and env, got %v and %v", root.Tags, root.Env)
+	}
+
+	api := cfg.Checks[1]
+	if api.Timeout != 2*time.Minute {
+		t.Errorf("expected the check's own timeout, got %v", api.Timeout)
+	}
+	if api.Shell != "bash -eo pipefail" || api.Retries != 0 {
+		t.Errorf("expected inherited shell and overridden retries, got %q and %d", api.Shell, api.Retries)
+	}
+	if !reflect.DeepEqual(api.Tags, []string{"api", "test"}) {
+		t.Errorf("expected tags [api test], got %v", api.Tags)
+	}
+	if api.Env["CI"] != "true" {
+		t.Errorf("expected inherited env, got %v", api.Env)
+	}
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/openark-net/qa/pkg/qa/infrastructure/glob"
+	"gopkg.in/yaml.v3"
+)
+
+const configName = ".qa.yml"
+
+// includeSpec is an item under includes:. It is either a path or glob, or
+// a mapping that also runs the included commands in dir: instead of next to
+// the included file, with env: as parameters, so one shared file can serve
+// as a template for many directories.
+type includeSpec struct {
+	Path string             `yaml:"path" schema:"required"`
+	Dir  string             `yaml:"dir"`
+	Env  map[string]located `yaml:"env"`
+
+	pos position
+}
+
+func (i *includeSpec) UnmarshalYAML(node *yaml.Node) error {
+	defer func() { i.pos = positionOf(node) }()
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&i.Path)
+	}
+
+	type plain includeSpec
+	return node.Decode((*plain)(i))
+}
+
+// include is a file to load on behalf of an includes: list or discovery.
+// Expanded includes came from a glob or discovery rather than being named
+// explicitly, so matching an ancestor is skipped instead of being a cycle.
+// dir, when set, is where the included commands run, and env holds the
+// parameters given by from, the including file.
+type include struct {
+	path     string
+	expanded bool
+	pos      position
+	dir      string
+	env      map[string]located
+	from     string
+}
+
+// includePaths resolves the includes of the file loaded as o. Paths are
+// relative to the file itself; a dir: is relative to where the file's own
+// commands run. Literal includes are passed through untouched so a missing
+// file is still reported; glob includes and discovery only yield files that
+// exist, in lexical order, with excluded and duplicate paths dropped.
+func (l *Loader) includePaths(o origin, file qaFile, state *loadState) ([]include, error) {
+	dir := path.Dir(o.file)
+	var paths []include
+	seen := make(map[string]bool)
+	add := func(p string, spec includeSpec) {
+		if !seen[p] && !excluded(dir, p, file.Exclude) {
+			seen[p] = true
+			paths = append(paths, include{path: p, expanded: true, dir: spec.Dir, env: spec.Env, from: o.file})
+		}
+	}
+
+	for _, inc := range file.Includes {
+		if strings.TrimSpace(inc.Path) == "" {
+			state.report(o.file, inc.pos, "include has an empty path")
+			continue
+		}
+		if inc.Dir != "" {
+			if !state.validDir(o.file, inc.pos, o.dir(), inc.Dir) {
+				continue
+			}
+			inc.Dir = path.Join(o.dir(), inc.Dir)
+		}
+
+		pattern := path.Join(dir, inc.Path)
+		if !glob.HasMeta(inc.Path) {
+			paths = append(paths, include{path: pattern, pos: inc.pos, dir: inc.Dir, env: inc.Env, from: o.file})
+			continue
+		}
+
+		matches, err := l.walk(glob.Base(pattern), dir, file.Exclude, func(p string) bool {
+			return glob.Match(pattern, p)
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			add(m, inc)
+		}
+	}
+
+	if file.Discover {
+		matches, err := l.walk(dir, dir, file.Exclude, func(p string) bool {
+			return path.Base(p) == configName
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			add(m, includeSpec{})
+		}
+	}
+
+	return paths, nil
+}
+
+// walk returns every file under root accepted by match, skipping hidden
+// and ignored directories and anything matching an exclude pattern relative
+// to dir.
+func (l *Loader) walk(root, dir string, exclude []string, match func(string) bool) ([]string, error) {
+	var matches []string
+	err := fs.WalkDir(l.fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ignored := p != root && l.ignored != nil && l.ignored(p)
+		if d.IsDir() {
+			if p != root && (strings.HasPrefix(d.Name(), ".") || ignored || excluded(dir, p, exclude)) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !ignored && match(p) {
+			matches = append(matches, p)
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return matches, err
+}
+
+func excluded(dir, p string, exclude []string) bool {
+	for _, pattern := range exclude {
+		if glob.Match(path.Join(dir, pattern), p) {
+			return true
+		}
+	}
+	return false
+}
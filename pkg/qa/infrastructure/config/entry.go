@@ -0,0 +1,123 @@
+package config
+
+import (
+	"path"
+	"time"
+
+	"github.com/openark-net/qa/pkg/qa/domain"
+	"gopkg.in/yaml.v3"
+)
+
+// entry is a single item under format: or checks:. It is either a bare
+// command string or a mapping carrying metadata alongside the command.
+type entry struct {
+	Name     string              `yaml:"name"`
+	Run      string              `yaml:"run" schema:"required"`
+	Env      map[string]string   `yaml:"env"`
+	Timeout  time.Duration       `yaml:"timeout"`
+	Shell    string              `yaml:"shell"`
+	Retries  *int                `yaml:"retries"`
+	Weight   int                 `yaml:"weight"`
+	Locks    []string            `yaml:"locks"`
+	Dir      string              `yaml:"dir"`
+	Inputs   inputs              `yaml:"inputs"`
+	External []string            `yaml:"external_inputs"`
+	Needs    []need              `yaml:"needs"`
+	When     when                `yaml:"when"`
+	Tags     []string            `yaml:"tags"`
+	Matrix   map[string][]string `yaml:"matrix"`
+
+	pos     position
+	variant map[string]string
+}
+
+// when holds the conditions under which an entry runs.
+type when struct {
+	Changed []string          `yaml:"changed"`
+	Env     map[string]string `yaml:"env"`
+	Branch  []string          `yaml:"branch"`
+}
+
+// inputs lists the globs, relative to the entry's directory, whose files
+// make up the check's cache key.
+type inputs struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+func (e *entry) UnmarshalYAML(node *yaml.Node) error {
+	defer func() { e.pos = positionOf(node) }()
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&e.Run)
+	}
+
+	type plain entry
+	return node.Decode((*plain)(e))
+}
+
+func (e entry) displayName() string {
+	if e.Name != "" {
+		return e.Name
+	}
+	return e.Run
+}
+
+func (e entry) command(o origin) domain.Command {
+	fileDir := o.dir()
+	var needs []domain.Ref
+	for _, n := range e.Needs {
+		needs = append(needs, n.ref(fileDir))
+	}
+
+	retries := 0
+	if e.Retries != nil {
+		retries = max(*e.Retries, 0)
+	}
+
+	return domain.Command{
+		Name:       e.Name,
+		Cmd:        e.Run,
+		WorkingDir: path.Join(fileDir, e.Dir),
+		Env:        e.Env,
+		Timeout:    e.Timeout,
+		Shell:      e.Shell,
+		Retries:    retries,
+		Weight:     e.Weight,
+		Locks:      e.Locks,
+		Inputs: domain.Inputs{
+			Include: e.Inputs.Include,
+			Exclude: e.Inputs.Exclude,
+		},
+		ExternalInputs: e.External,
+		Needs:          needs,
+		When: domain.Condition{
+			Changed: e.When.Changed,
+			Env:     e.When.Env,
+			Branch:  e.When.Branch,
+		},
+		Tags:    e.Tags,
+		Variant: e.variant,
+		Origin: domain.Origin{
+			File:   o.file,
+			Line:   e.pos.line,
+			Column: e.pos.column,
+			Via:    o.via,
+		},
+	}
+}
+
+// origin is the file entries are being loaded from and the chain of files
+// that included it. base is the directory its entries run in when an
+// include moved them away from the file's own directory.
+type origin struct {
+	file string
+	base string
+	via  []string
+}
+
+func (o origin) dir() string {
+	if o.base != "" {
+		return o.base
+	}
+	return path.Dir(o.file)
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"io/fs"
+	"maps"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// reference matches ${VAR} and ${VAR:-default}, and the $${ escape that
+// leaves a literal ${ for the shell.
+var reference = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// fileEnv returns the environment for the entries of file: the inherited
+// variables of the files that included it, overlaid with its env_file, its
+// defaults' env and then its env: block. Values may refer to inherited
+// variables, to variables from the env_file and to the process environment.
+func (s *loadState) fileEnv(file string, parsed qaFile, inherited map[string]string) map[string]string {
+	env := maps.Clone(inherited)
+	if env == nil {
+		env = make(map[string]string)
+	}
+
+	if parsed.EnvFile.Value != "" {
+		maps.Copy(env, s.readEnvFile(file, parsed.EnvFile, env))
+	}
+
+	outer := maps.Clone(env)
+	for _, vars := range []map[string]located{parsed.Defaults.Env, parsed.Env} {
+		for key, value := range vars {
+			env[key] = s.interpolate(file, value.pos, value.Value, outer)
+		}
+	}
+	return env
+}
+
+// readEnvFile parses the dotenv file named by ref: KEY=VALUE lines with
+// optional export prefixes, quotes and # comments. Single-quoted values are
+// taken literally; everything else is interpolated.
+func (s *loadState) readEnvFile(file string, ref located, known map[string]string) map[string]string {
+	envFile := path.Join(path.Dir(file), ref.Value)
+	data, err := fs.ReadFile(s.fsys, envFile)
+	if err != nil {
+		s.report(file, ref.pos, "env_file %s not found", envFile)
+		return nil
+	}
+
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(strings.TrimPrefix(text, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || !isVarName(key) {
+			s.report(envFile, position{line: line, column: 1}, "expected KEY=VALUE")
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			vars[key] = value[1 : len(value)-1]
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			vars[key] = s.interpolate(envFile, position{line: line, column: 1}, value[1:len(value)-1], known)
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+			vars[key] = s.interpolate(envFile, position{line: line, column: 1}, value, known)
+		}
+	}
+	return vars
+}
+
+// expandEntries fills in the defaults of sc that each entry leaves unset,
+// gives it the environment of sc overlaid with its own env:, and
+// interpolates the entry's env values and command.
+func (s *loadState) expandEntries(file string, entries []entry, sc scope) []entry {
+	env := sc.env
+	for i, e := range entries {
+		e = sc.defaults.apply(e)
+		entries[i] = e
+
+		merged := maps.Clone(env)
+		if merged == nil {
+			merged = make(map[string]string)
+		}
+		for key, value := range e.Env {
+			merged[key] = s.interpolate(file, e.pos, value, env)
+		}
+		if len(merged) == 0 {
+			merged = nil
+		}
+
+		entries[i].Env = merged
+		entries[i].Run = s.interpolate(file, e.pos, e.Run, merged)
+	}
+	return entries
+}
+
+// interpolate replaces variable references in value with their values from
+// known or, failing that, the process environment. A default applies when
+// the variable is unset or empty; an undefined variable without one is
+// reported and left in place.
+func (s *loadState) interpolate(file string, pos position, value string, known map[string]string) string {
+	return reference.ReplaceAllStringFunc(value, func(ref string) string {
+		if ref == "$${" {
+			return "${"
+		}
+
+		match := reference.FindStringSubmatch(ref)
+		name, hasDefault, fallback := match[1], match[2] != "", match[3]
+
+		v, ok := known[name]
+		if !ok {
+			v, ok = s.lookupEnv(name)
+		}
+		switch {
+		case hasDefault && v == "":
+			return fallback
+		case !ok:
+			s.report(file, pos, "undefined variable %s; set it or give a default with ${%s:-value}", name, name)
+			return ref
+		}
+		return v
+	})
+}
+
+func isVarName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func lookupFrom(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func TestLoad_EnvCascadesThroughIncludes(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`env_file: .env
+env:
+  GOFLAGS: -mod=${MODE}
+  REGION: eu
+includes:
+  - api/.qa.yml
+checks:
+  - run: go test ${GOFLAGS} ./...
+`),
+		},
+		".env": &fstest.MapFile{
+			Data: []byte(`# shared settings
+MODE=readonly
+export TOKEN='${literal}'
+`),
+		},
+		"api/.qa.yml": &fstest.MapFile{
+			Data: []byte(`env:
+  REGION: us
+checks:
+  - name: deploy
+    run: ./deploy --region ${REGION} --home ${HOME}
+    env:
+      TARGET: ${REGION}-${STAGE:-dev}
+`),
+		},
+	}
+
+	cfg, err := New(fsys, WithLookupEnv(lookupFrom(map[string]string{"HOME": "/home/ci"}))).Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Checks) != 2 {
+		t.Fatalf("expected 2 checks, got %d", len(cfg.Checks))
+	}
+
+	root := cfg.Checks[0]
+	if root.Cmd != "go test -mod=readonly ./..." {
+		t.Errorf("unexpected root command %q", root.Cmd)
+	}
+	wantRoot := map[string]string{"MODE": "readonly", "TOKEN": "${literal}", "GOFLAGS": "-mod=readonly", "REGION": "eu"}
+	if !reflect.DeepEqual(root.Env, wantRoot) {
+		t.Errorf("expected root env %v, got %v", wantRoot, root.Env)
+	}
+
+	deploy := cfg.Checks[1]
+	if deploy.Cmd != "./deploy --region us --home /home/ci" {
+		t.Errorf("unexpected deploy command %q", deploy.Cmd)
+	}
+	if deploy.Env["REGION"] != "us" || deploy.Env["TARGET"] != "us-dev" || deploy.Env["GOFLAGS"] != "-mod=readonly" {
+		t.Errorf("unexpected deploy env %v", deploy.Env)
+	}
+}
+
+func TestLoad_EnvEscapedReference(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - for f in *.sh; do shellcheck "$${f}"; done
+`),
+		},
+	}
+
+	cfg, err := New(fsys, WithLookupEnv(lookupFrom(nil))).Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Checks[0].Cmd; got != `for f in *.sh; do shellcheck "${f}"; done` {
+		t.Errorf("unexpected command %q", got)
+	}
+	if cfg.Checks[0].Env != nil {
+		t.Errorf("expected no env, got %v", cfg.Checks[0].Env)
+	}
+}
+
+func TestLoad_EnvUndefinedVariables(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`env_file: missing.env
+env:
+  URL: https://${HOST}
+checks:
+  - run: curl ${URL}/${API_PATH}
+`),
+		},
+	}
+
+	_, err := New(fsys, WithLookupEnv(lookupFrom(nil))).Load(".")
+
+	var issues ValidationErrors
+	if !errors.As(err, &issues) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+
+	want := []string{
+		".qa.yml:1:11: env_file missing.env not found",
+		".qa.yml:3:8: undefined variable HOST; set it or give a default with ${HOST:-value}",
+		".qa.yml:5:5: undefined variable API_PATH; set it or give a default with ${API_PATH:-value}",
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("expected %d issues, got %d:\n%v", len(want), len(issues), issues)
+	}
+	for i, w := range want {
+		if got := issues[i].Error(); got != w {
+			t.Errorf("issue %d: expected %q, got %q", i, w, got)
+		}
+	}
+}
+
+func TestLoad_EnvFileMalformedLine(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte("env_file: .env\nchecks:\n  - go test ./...\n"),
+		},
+		".env": &fstest.MapFile{
+			Data: []byte("A=1\nnot a variable\n"),
+		},
+	}
+
+	_, err := New(fsys, WithLookupEnv(lookupFrom(nil))).Load(".")
+
+	var issues ValidationErrors
+	if !errors.As(err, &issues) || len(issues) != 1 {
+		t.Fatalf("expected one validation error, got %v", err)
+	}
+	if got := issues[0].Error(); got != ".env:2:1: expected KEY=VALUE" {
+		t.Errorf("unexpected issue %q", got)
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 )
@@ -27,3 +28,47 @@ func FindConfig(startDir string) (string, error) {
 		dir = parent
 	}
 }
+
+// ResolveConfig locates an explicitly chosen config: a file, or a directory
+// containing a .qa.yml. It returns the root to load it from, which is the
+// enclosing git repository or else the file's own directory, and the file's
+// slash-separated path relative to that root.
+func ResolveConfig(configPath string) (root, file string, err error) {
+	abs, err := filepath.Abs(configPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", "", fmt.Errorf("config %s: %w", configPath, err)
+	}
+	if info.IsDir() {
+		abs = filepath.Join(abs, ".qa.yml")
+		if _, err := os.Stat(abs); err != nil {
+			return "", "", fmt.Errorf("config %s: %w", configPath, ErrConfigNotFound)
+		}
+	}
+
+	root = repoRoot(filepath.Dir(abs))
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return "", "", err
+	}
+	return root, filepath.ToSlash(rel), nil
+}
+
+// repoRoot returns the nearest directory at or above dir that contains
+// .git, or dir itself when there is none.
+func repoRoot(dir string) string {
+	for current := dir; ; {
+		if _, err := os.Stat(filepath.Join(current, ".git")); err == nil {
+			return current
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return dir
+		}
+		current = parent
+	}
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -87,6 +88,73 @@ func TestFindConfig_StopsAtFirstMatch(t *testing.T) {
 	}
 }
 
+func TestResolveConfig_FileInRepository(t *testing.T) {
+	tmpDir := t.TempDir()
+	ciDir := filepath.Join(tmpDir, "ci")
+	if err := os.MkdirAll(filepath.Join(tmpDir, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(ciDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	createFile(t, filepath.Join(ciDir, "nightly.yml"))
+
+	root, file, err := ResolveConfig(filepath.Join(ciDir, "nightly.yml"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if root != tmpDir || file != "ci/nightly.yml" {
+		t.Errorf("expected %q and ci/nightly.yml, got %q and %q", tmpDir, root, file)
+	}
+}
+
+func TestResolveConfig_DirectoryOutsideRepository(t *testing.T) {
+	tmpDir := t.TempDir()
+	createFile(t, filepath.Join(tmpDir, ".qa.yml"))
+
+	root, file, err := ResolveConfig(tmpDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if root != tmpDir || file != ".qa.yml" {
+		t.Errorf("expected %q and .qa.yml, got %q and %q", tmpDir, root, file)
+	}
+}
+
+func TestResolveConfig_FoundDirectoryBelowRepository(t *testing.T) {
+	tmpDir := t.TempDir()
+	ciDir := filepath.Join(tmpDir, "ci")
+	if err := os.MkdirAll(filepath.Join(tmpDir, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(ciDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	createFile(t, filepath.Join(ciDir, ".qa.yml"))
+
+	found, err := FindConfig(ciDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	root, file, err := ResolveConfig(found)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if root != tmpDir || file != "ci/.qa.yml" {
+		t.Errorf("expected %q and ci/.qa.yml, got %q and %q", tmpDir, root, file)
+	}
+}
+
+func TestResolveConfig_DirectoryWithoutConfig(t *testing.T) {
+	_, _, err := ResolveConfig(t.TempDir())
+	if !errors.Is(err, ErrConfigNotFound) {
+		t.Errorf("expected ErrConfigNotFound, got %v", err)
+	}
+}
+
 func createFile(t *testing.T, path string) {
 	t.Helper()
 	f, err := os.Create(path)
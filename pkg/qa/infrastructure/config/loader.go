@@ -1,50 +1,192 @@
 package config
 
 import (
+	"cmp"
 	"fmt"
 	"io/fs"
+	"maps"
+	"os"
 	"path"
+	"reflect"
+	"slices"
+	"strings"
 
 	"github.com/openark-net/qa/pkg/qa/domain"
 	"gopkg.in/yaml.v3"
 )
 
 type qaFile struct {
-	Includes []string `yaml:"includes"`
-	Format   []string `yaml:"format"`
-	Checks   []string `yaml:"checks"`
+	Includes []includeSpec      `yaml:"includes"`
+	Discover bool               `yaml:"discover"`
+	Exclude  []string           `yaml:"exclude"`
+	Preset   presetSpec         `yaml:"preset"`
+	Presets  []presetSpec       `yaml:"presets"`
+	Defaults defaults           `yaml:"defaults"`
+	Env      map[string]located `yaml:"env"`
+	EnvFile  located            `yaml:"env_file"`
+	Format   []entry            `yaml:"format"`
+	Checks   []entry            `yaml:"checks"`
+	Profiles map[string]profile `yaml:"profiles"`
 }
 
 type Loader struct {
-	fsys fs.FS
+	fsys      fs.FS
+	profile   string
+	lookupEnv func(string) (string, bool)
+	ignored   func(string) bool
 }
 
-func New(fsys fs.FS) *Loader {
-	return &Loader{fsys: fsys}
+type Option func(*Loader)
+
+// WithProfile selects the named profile from the profiles: blocks of the
+// loaded files.
+func WithProfile(name string) Option {
+	return func(l *Loader) {
+		l.profile = name
+	}
+}
+
+// WithLookupEnv sets where ${VAR} references not defined by the config are
+// resolved. It defaults to the process environment.
+func WithLookupEnv(lookup func(string) (string, bool)) Option {
+	return func(l *Loader) {
+		l.lookupEnv = lookup
+	}
+}
+
+// WithIgnored skips the files and directories ignored reports, such as
+// those git ignores, when expanding glob includes and discovery. Paths are
+// slash-separated and relative to the loader's file system.
+func WithIgnored(ignored func(path string) bool) Option {
+	return func(l *Loader) {
+		l.ignored = ignored
+	}
+}
+
+func New(fsys fs.FS, opts ...Option) *Loader {
+	l := &Loader{fsys: fsys, lookupEnv: os.LookupEnv}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
 }
 
 func (l *Loader) Load(rootPath string) (domain.ConfigSet, error) {
-	configPath := path.Join(rootPath, ".qa.yml")
-	visited := make(map[string]bool)
-	return l.loadFile(configPath, visited)
+	return l.LoadFile(path.Join(rootPath, configName))
+}
+
+// LoadFile loads the config at configPath, which may have any name, along
+// with everything it includes. Working directories are relative to the
+// root of the loader's file system rather than to configPath.
+func (l *Loader) LoadFile(configPath string) (domain.ConfigSet, error) {
+	state := newLoadState(l.fsys, l.lookupEnv)
+
+	cfg, err := l.loadFile(include{path: configPath}, scope{}, state)
+	if err != nil {
+		return domain.ConfigSet{}, err
+	}
+
+	state.duplicateChecks(cfg.Checks)
+	if l.profile != "" && !state.profiles[l.profile] {
+		state.report(path.Clean(configPath), position{line: 1, column: 1}, "profile %q is not defined in any .qa.yml", l.profile)
+	}
+	cfg.Checks = state.resolveNeeds(cfg.Checks)
+
+	if len(state.issues) > 0 {
+		return domain.ConfigSet{}, state.sortedIssues()
+	}
+	return cfg, nil
+}
+
+// loadState tracks the chain of files currently being included and every
+// file loaded so far. A file reached twice through different parents (a
+// diamond) is loaded once; a file that appears in its own chain is a cycle.
+// It also records every profile name seen so an unknown one can be reported,
+// the checks profiles and local overlays removed so needs on them can be
+// dropped, and every validation issue so they can be reported together.
+type loadState struct {
+	fsys      fs.FS
+	lookupEnv func(string) (string, bool)
+	stack     []string
+	loaded    map[string]bool
+	profiles  map[string]bool
+	removed   []domain.Command
+	issues    ValidationErrors
+}
+
+func newLoadState(fsys fs.FS, lookupEnv func(string) (string, bool)) *loadState {
+	return &loadState{
+		fsys:      fsys,
+		lookupEnv: lookupEnv,
+		loaded:    make(map[string]bool),
+		profiles:  make(map[string]bool),
+	}
+}
+
+func (s *loadState) onStack(p string) bool {
+	for _, entry := range s.stack {
+		if entry == p {
+			return true
+		}
+	}
+	return false
 }
 
-func (l *Loader) loadFile(filePath string, visited map[string]bool) (domain.ConfigSet, error) {
-	cleanPath := path.Clean(filePath)
+func (s *loadState) chain(p string) string {
+	return strings.Join(append(s.stack, p), " -> ")
+}
+
+// loadFile loads inc and everything it includes. parent holds the
+// environment and defaults of the including files. The include's env:, then
+// the file's own env_file, defaults and env: block extend them for the file
+// and its includes. A file reached through two parents keeps the scope of
+// the first, unless the two run it in different directories.
+func (l *Loader) loadFile(inc include, parent scope, state *loadState) (domain.ConfigSet, error) {
+	cleanPath := path.Clean(inc.path)
+	o := origin{file: cleanPath, base: inc.dir, via: slices.Clone(state.stack)}
 
-	if visited[cleanPath] {
-		return domain.ConfigSet{}, fmt.Errorf("circular include detected: %s", cleanPath)
+	if state.onStack(cleanPath) {
+		return domain.ConfigSet{}, fmt.Errorf("circular include detected: %s", state.chain(cleanPath))
+	}
+	key := cleanPath + " in " + o.dir()
+	if state.loaded[key] {
+		return domain.ConfigSet{}, nil
 	}
-	visited[cleanPath] = true
+	state.loaded[key] = true
+	state.stack = append(state.stack, cleanPath)
+	defer func() { state.stack = state.stack[:len(state.stack)-1] }()
 
 	data, err := fs.ReadFile(l.fsys, cleanPath)
 	if err != nil {
 		return domain.ConfigSet{}, fmt.Errorf("reading %s: %w", cleanPath, err)
 	}
 
-	var file qaFile
-	if err := yaml.Unmarshal(data, &file); err != nil {
-		return domain.ConfigSet{}, fmt.Errorf("parsing %s: %w", cleanPath, err)
+	file, err := state.parse(o, data)
+	if err != nil {
+		return domain.ConfigSet{}, err
+	}
+
+	inherited := parent.env
+	if len(inc.env) > 0 {
+		outer := inherited
+		inherited = maps.Clone(inherited)
+		if inherited == nil {
+			inherited = make(map[string]string, len(inc.env))
+		}
+		for key, value := range inc.env {
+			inherited[key] = state.interpolate(inc.from, value.pos, value.Value, outer)
+		}
+	}
+	sc := scope{
+		env:      state.fileEnv(cleanPath, file, inherited),
+		defaults: parent.defaults.merge(file.Defaults),
+	}
+	file.Format = state.expandEntries(cleanPath, file.Format, sc)
+	file.Checks = state.expandEntries(cleanPath, file.Checks, sc)
+	for name, p := range file.Profiles {
+		p.Add = state.expandEntries(cleanPath, p.Add, sc)
+		p.Override = state.expandEntries(cleanPath, p.Override, sc)
+		file.Profiles[name] = p
 	}
 
 	dir := path.Dir(cleanPath)
@@ -52,30 +194,207 @@ func (l *Loader) loadFile(filePath string, visited map[string]bool) (domain.Conf
 		Format: make(map[string][]domain.Command),
 	}
 
-	for _, cmdStr := range file.Format {
-		result.Format[dir] = append(result.Format[dir], domain.Command{
-			Cmd:        cmdStr,
-			WorkingDir: dir,
-		})
+	specs := file.Presets
+	if file.Preset.Name != "" {
+		specs = append([]presetSpec{file.Preset}, specs...)
+	}
+	for _, spec := range specs {
+		preset, err := state.loadPreset(spec, o, sc)
+		if err != nil {
+			return domain.ConfigSet{}, err
+		}
+		result = merge(result, preset)
+	}
+
+	for _, e := range file.Format {
+		cmd := e.command(o)
+		result.Format[cmd.WorkingDir] = append(result.Format[cmd.WorkingDir], cmd)
+	}
+
+	for _, e := range file.Checks {
+		result.Checks = append(result.Checks, e.command(o))
 	}
 
-	for _, cmdStr := range file.Checks {
-		result.Checks = append(result.Checks, domain.Command{
-			Cmd:        cmdStr,
-			WorkingDir: dir,
-		})
+	includes, err := l.includePaths(o, file, state)
+	if err != nil {
+		return domain.ConfigSet{}, fmt.Errorf("resolving includes of %s: %w", cleanPath, err)
 	}
 
-	for _, include := range file.Includes {
-		includePath := path.Join(dir, include)
-		included, err := l.loadFile(includePath, visited)
+	for _, inc := range includes {
+		if inc.expanded && state.onStack(inc.path) {
+			continue
+		}
+		if !inc.expanded && !state.onStack(inc.path) {
+			if _, err := fs.Stat(l.fsys, inc.path); err != nil {
+				state.report(cleanPath, inc.pos, "included file %s not found", inc.path)
+				continue
+			}
+		}
+		included, err := l.loadFile(inc, sc, state)
 		if err != nil {
 			return domain.ConfigSet{}, err
 		}
 		result = merge(result, included)
 	}
 
-	return result, nil
+	for name := range file.Profiles {
+		state.profiles[name] = true
+	}
+	if p, ok := file.Profiles[l.profile]; ok {
+		result.Checks = p.apply(l.profile, result.Checks, o, state)
+	}
+
+	// Other config files in the directory, such as an included ci.qa.yml,
+	// leave the overlay to the .qa.yml, so it is applied only once.
+	if path.Base(cleanPath) != configName && len(o.via) > 0 {
+		return result, nil
+	}
+	return l.applyLocal(dir, sc, result, state)
+}
+
+// parse decodes data into a qaFile, recording unknown keys, entries
+// without a command and duplicate entries as validation issues. Invalid
+// entries are dropped so loading can continue and report everything.
+func (s *loadState) parse(o origin, data []byte) (qaFile, error) {
+	file := o.file
+	var parsed qaFile
+	if err := s.decode(file, data, &parsed); err != nil {
+		return qaFile{}, err
+	}
+
+	parsed.Format = s.expandMatrix(file, s.validEntries(o, "format", parsed.Format))
+	parsed.Checks = s.expandMatrix(file, s.validEntries(o, "check", parsed.Checks))
+	for name, p := range parsed.Profiles {
+		p.Add = s.expandMatrix(file, s.validEntries(o, "check", p.Add))
+		p.Override = s.noMatrix(file, "override", s.validEntries(o, "override", p.Override))
+		parsed.Profiles[name] = p
+	}
+	return parsed, nil
+}
+
+// decode unmarshals data into out, recording keys out has no field for.
+func (s *loadState) decode(file string, data []byte, out any) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parsing %s: %w", file, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+
+	s.checkKeys(file, &doc, reflect.TypeOf(out))
+	if err := doc.Decode(out); err != nil {
+		return fmt.Errorf("parsing %s: %w", file, err)
+	}
+	return nil
+}
+
+func (s *loadState) validEntries(o origin, kind string, entries []entry) []entry {
+	file := o.file
+	seen := make(map[string]entry, len(entries))
+	valid := entries[:0]
+	for _, e := range entries {
+		if strings.TrimSpace(e.Run) == "" {
+			s.report(file, e.pos, "%s has an empty command", kind)
+			continue
+		}
+		if e.Dir != "" && !s.validDir(file, e.pos, o.dir(), e.Dir) {
+			continue
+		}
+		if e.Retries != nil && *e.Retries < 0 {
+			s.report(file, e.pos, "%s %q has negative retries", kind, e.displayName())
+			continue
+		}
+		if e.Weight < 0 {
+			s.report(file, e.pos, "%s %q has negative weight", kind, e.displayName())
+			continue
+		}
+		if slices.ContainsFunc(e.Locks, func(l string) bool { return strings.TrimSpace(l) == "" }) {
+			s.report(file, e.pos, "%s %q has an empty lock name", kind, e.displayName())
+			continue
+		}
+		if kind == "format" {
+			if field := checkOnlyField(e); field != "" {
+				s.report(file, e.pos, "format %q cannot set %s, which only applies to checks", e.displayName(), field)
+				continue
+			}
+		}
+
+		key := path.Clean(e.Dir) + ":" + e.displayName()
+		if first, ok := seen[key]; ok {
+			s.report(file, e.pos, "duplicate %s %q, first defined at line %d", kind, e.displayName(), first.pos.line)
+			continue
+		}
+		seen[key] = e
+		valid = append(valid, e)
+	}
+	return valid
+}
+
+// checkOnlyField returns the first field set on e that format commands would
+// silently ignore, since they run in file order ahead of every check and are
+// never cached.
+func checkOnlyField(e entry) string {
+	switch {
+	case len(e.Needs) > 0:
+		return "needs"
+	case len(e.Inputs.Include) > 0 || len(e.Inputs.Exclude) > 0:
+		return "inputs"
+	case len(e.External) > 0:
+		return "external_inputs"
+	}
+	return ""
+}
+
+// duplicateChecks reports checks that end up with the same directory and
+// name once every include, preset, profile and local overlay is applied,
+// since they could not be told apart in the cache, output or needs.
+func (s *loadState) duplicateChecks(checks []domain.Command) {
+	first := make(map[domain.Ref]domain.Command, len(checks))
+	for _, c := range checks {
+		ref := c.Ref()
+		prev, ok := first[ref]
+		if !ok {
+			first[ref] = c
+			continue
+		}
+		pos := position{line: c.Origin.Line, column: c.Origin.Column}
+		s.report(c.Origin.File, pos, "duplicate check %q in %s, first defined at %s", ref.Name, ref.WorkingDir, prev.Origin)
+	}
+}
+
+// validDir reports whether dir, relative to base, names an existing
+// directory inside the config root, recording an issue when it does not.
+func (s *loadState) validDir(file string, pos position, base, dir string) bool {
+	if path.IsAbs(dir) {
+		s.report(file, pos, "dir %q must be relative to the config file", dir)
+		return false
+	}
+
+	joined := path.Join(base, dir)
+	if joined == ".." || strings.HasPrefix(joined, "../") {
+		s.report(file, pos, "dir %q is outside the repository", dir)
+		return false
+	}
+
+	info, err := fs.Stat(s.fsys, joined)
+	if err != nil || !info.IsDir() {
+		s.report(file, pos, "dir %q is not a directory", dir)
+		return false
+	}
+	return true
+}
+
+func (s *loadState) sortedIssues() ValidationErrors {
+	issues := slices.Clone(s.issues)
+	slices.SortStableFunc(issues, func(a, b ValidationError) int {
+		return cmp.Or(
+			strings.Compare(a.File, b.File),
+			cmp.Compare(a.Line, b.Line),
+			cmp.Compare(a.Column, b.Column),
+		)
+	})
+	return issues
 }
 
 func merge(a, b domain.ConfigSet) domain.ConfigSet {
@@ -83,5 +402,7 @@ func merge(a, b domain.ConfigSet) domain.ConfigSet {
 		a.Format[dir] = append(a.Format[dir], cmds...)
 	}
 	a.Checks = append(a.Checks, b.Checks...)
+	a.Overlays = append(a.Overlays, b.Overlays...)
+	a.Jobs = max(a.Jobs, b.Jobs)
 	return a
 }
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"errors"
 	"testing"
 	"testing/fstest"
+	"time"
 
 	"github.com/openark-net/qa/pkg/qa/domain"
 )
@@ -160,6 +162,743 @@ func TestLoad_CircularInclude(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected circular include error")
 	}
+
+	want := "circular include detected: .qa.yml -> a/.qa.yml -> a/b/.qa.yml -> .qa.yml"
+	if err.Error() != want {
+		t.Errorf("expected error %q, got %q", want, err.Error())
+	}
+}
+
+func TestLoad_DiamondInclude(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`includes:
+  - "api/.qa.yml"
+  - "web/.qa.yml"
+`),
+		},
+		"api/.qa.yml": &fstest.MapFile{
+			Data: []byte(`includes:
+  - "../shared/.qa.yml"
+checks:
+  - "api-check"
+`),
+		},
+		"web/.qa.yml": &fstest.MapFile{
+			Data: []byte(`includes:
+  - "../shared/.qa.yml"
+checks:
+  - "web-check"
+`),
+		},
+		"shared/.qa.yml": &fstest.MapFile{
+			Data: []byte(`format:
+  - "shared-fmt"
+checks:
+  - "shared-check"
+`),
+		},
+	}
+
+	loader := New(fsys)
+	cfg, err := loader.Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(cfg.Checks) != 3 {
+		t.Fatalf("expected 3 check commands, got %d", len(cfg.Checks))
+	}
+	assertCommand(t, cfg.Checks[0], "api-check", "api")
+	assertCommand(t, cfg.Checks[1], "shared-check", "shared")
+	assertCommand(t, cfg.Checks[2], "web-check", "web")
+
+	if len(cfg.Format["shared"]) != 1 {
+		t.Errorf("expected shared format command once, got %d", len(cfg.Format["shared"]))
+	}
+}
+
+func TestLoad_SelfInclude(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`includes:
+  - ".qa.yml"
+`),
+		},
+	}
+
+	loader := New(fsys)
+	_, err := loader.Load(".")
+	if err == nil {
+		t.Fatal("expected circular include error")
+	}
+}
+
+func TestLoad_StructuredEntries(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`format:
+  - name: prettier
+    run: npx prettier --write .
+    dir: web
+checks:
+  - go vet ./...
+  - name: jest
+    run: npm run test -- --ci
+    env:
+      CI: "true"
+    timeout: 10m
+    dir: web
+`),
+		},
+		"web/package.json": &fstest.MapFile{},
+	}
+
+	loader := New(fsys)
+	cfg, err := loader.Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	webFmt := cfg.Format["web"]
+	if len(webFmt) != 1 {
+		t.Fatalf("expected 1 web format command, got %d", len(webFmt))
+	}
+	assertCommand(t, webFmt[0], "npx prettier --write .", "web")
+	if webFmt[0].Name != "prettier" {
+		t.Errorf("expected name %q, got %q", "prettier", webFmt[0].Name)
+	}
+
+	if len(cfg.Checks) != 2 {
+		t.Fatalf("expected 2 check commands, got %d", len(cfg.Checks))
+	}
+	assertCommand(t, cfg.Checks[0], "go vet ./...", ".")
+	if cfg.Checks[0].DisplayName() != "go vet ./..." {
+		t.Errorf("expected bare entry to display its command, got %q", cfg.Checks[0].DisplayName())
+	}
+
+	jest := cfg.Checks[1]
+	assertCommand(t, jest, "npm run test -- --ci", "web")
+	if jest.DisplayName() != "jest" {
+		t.Errorf("expected display name %q, got %q", "jest", jest.DisplayName())
+	}
+	if jest.Env["CI"] != "true" {
+		t.Errorf("expected env CI=true, got %v", jest.Env)
+	}
+	if jest.Timeout != 10*time.Minute {
+		t.Errorf("expected timeout 10m, got %v", jest.Timeout)
+	}
+}
+
+func TestLoad_EntryInputs(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - run: go test ./...
+    inputs:
+      include: ["**/*.go", "go.mod"]
+      exclude: ["docs/**"]
+    external_inputs:
+      - proto
+      - package-lock.json
+`),
+		},
+	}
+
+	cfg, err := New(fsys).Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	inputs := cfg.Checks[0].Inputs
+	if len(inputs.Include) != 2 || inputs.Include[0] != "**/*.go" || inputs.Include[1] != "go.mod" {
+		t.Errorf("unexpected include globs %v", inputs.Include)
+	}
+	if len(inputs.Exclude) != 1 || inputs.Exclude[0] != "docs/**" {
+		t.Errorf("unexpected exclude globs %v", inputs.Exclude)
+	}
+
+	external := cfg.Checks[0].ExternalInputs
+	if len(external) != 2 || external[0] != "proto" || external[1] != "package-lock.json" {
+		t.Errorf("unexpected external inputs %v", external)
+	}
+}
+
+func TestLoad_EntryWhenAndTags(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - run: terraform validate
+    when:
+      changed: ["**/*.tf"]
+      env:
+        CI: "true"
+      branch: [main, "release/*"]
+    tags: [slow, infra]
+`),
+		},
+	}
+
+	cfg, err := New(fsys).Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	when := cfg.Checks[0].When
+	if len(when.Changed) != 1 || when.Changed[0] != "**/*.tf" {
+		t.Errorf("unexpected changed globs %v", when.Changed)
+	}
+	if when.Env["CI"] != "true" {
+		t.Errorf("unexpected env %v", when.Env)
+	}
+	if len(when.Branch) != 2 || when.Branch[1] != "release/*" {
+		t.Errorf("unexpected branches %v", when.Branch)
+	}
+	if tags := cfg.Checks[0].Tags; len(tags) != 2 || tags[0] != "slow" || tags[1] != "infra" {
+		t.Errorf("unexpected tags %v", tags)
+	}
+}
+
+func TestLoad_EntryWithoutRun(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - name: orphan
+`),
+		},
+	}
+
+	loader := New(fsys)
+	_, err := loader.Load(".")
+	if err == nil {
+		t.Fatal("expected error for entry without run")
+	}
+}
+
+func TestLoad_RecordsOrigin(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`includes:
+  - "level1/.qa.yml"
+`),
+		},
+		"level1/.qa.yml": &fstest.MapFile{
+			Data: []byte(`includes:
+  - "level2/.qa.yml"
+`),
+		},
+		"level1/level2/.qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - go vet ./...
+  - name: test
+    run: go test ./...
+`),
+		},
+	}
+
+	cfg, err := New(fsys).Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	origin := cfg.Checks[1].Origin
+	if got := origin.String(); got != "level1/level2/.qa.yml:3" {
+		t.Errorf("expected origin level1/level2/.qa.yml:3, got %q", got)
+	}
+	if len(origin.Via) != 2 || origin.Via[0] != ".qa.yml" || origin.Via[1] != "level1/.qa.yml" {
+		t.Errorf("unexpected include chain %v", origin.Via)
+	}
+}
+
+func TestLoad_GlobIncludes(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`includes:
+  - "services/*/.qa.yml"
+`),
+		},
+		"services/api/.qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - "api-check"
+`),
+		},
+		"services/web/.qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - "web-check"
+`),
+		},
+		"services/web/nested/.qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - "nested-check"
+`),
+		},
+	}
+
+	loader := New(fsys)
+	cfg, err := loader.Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(cfg.Checks) != 2 {
+		t.Fatalf("expected 2 check commands, got %d", len(cfg.Checks))
+	}
+	assertCommand(t, cfg.Checks[0], "api-check", "services/api")
+	assertCommand(t, cfg.Checks[1], "web-check", "services/web")
+}
+
+func TestLoad_DoubleStarIncludeSkipsSelf(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`includes:
+  - "**/.qa.yml"
+checks:
+  - "root-check"
+`),
+		},
+		"a/b/.qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - "deep-check"
+`),
+		},
+	}
+
+	loader := New(fsys)
+	cfg, err := loader.Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(cfg.Checks) != 2 {
+		t.Fatalf("expected 2 check commands, got %d", len(cfg.Checks))
+	}
+	assertCommand(t, cfg.Checks[0], "root-check", ".")
+	assertCommand(t, cfg.Checks[1], "deep-check", "a/b")
+}
+
+func TestLoad_Discover(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`discover: true
+exclude:
+  - "vendor/**"
+checks:
+  - "root-check"
+`),
+		},
+		"api/.qa.yml": &fstest.MapFile{
+			Data: []byte(`discover: true
+checks:
+  - "api-check"
+`),
+		},
+		"api/worker/.qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - "worker-check"
+`),
+		},
+		"vendor/lib/.qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - "vendored-check"
+`),
+		},
+		".git/.qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - "hidden-check"
+`),
+		},
+	}
+
+	loader := New(fsys)
+	cfg, err := loader.Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(cfg.Checks) != 3 {
+		t.Fatalf("expected 3 check commands, got %d: %v", len(cfg.Checks), cfg.Checks)
+	}
+	assertCommand(t, cfg.Checks[0], "root-check", ".")
+	assertCommand(t, cfg.Checks[1], "api-check", "api")
+	assertCommand(t, cfg.Checks[2], "worker-check", "api/worker")
+}
+
+func TestLoad_DiscoverSkipsIgnored(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`discover: true
+includes:
+  - "web/**/.qa.yml"
+checks:
+  - "root-check"
+`),
+		},
+		"web/.qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - "web-check"
+`),
+		},
+		"web/node_modules/pkg/.qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - "dependency-check"
+`),
+		},
+		"scratch/.qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - "ignored-check"
+`),
+		},
+	}
+
+	ignored := func(p string) bool {
+		return p == "web/node_modules" || p == "scratch/.qa.yml"
+	}
+	cfg, err := New(fsys, WithIgnored(ignored)).Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(cfg.Checks) != 2 {
+		t.Fatalf("expected 2 check commands, got %d: %v", len(cfg.Checks), cfg.Checks)
+	}
+	assertCommand(t, cfg.Checks[0], "root-check", ".")
+	assertCommand(t, cfg.Checks[1], "web-check", "web")
+}
+
+func TestLoad_Profile(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`includes:
+  - "api/.qa.yml"
+checks:
+  - go vet ./...
+  - name: test
+    run: go test ./...
+profiles:
+  fast:
+    remove:
+      - test
+  full:
+    override:
+      - name: test
+        run: go test -race ./...
+    add:
+      - govulncheck ./...
+`),
+		},
+		"api/.qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - name: api-test
+    run: go test ./...
+profiles:
+  fast:
+    remove:
+      - api-test
+`),
+		},
+	}
+
+	cfg, err := New(fsys, WithProfile("fast")).Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Checks) != 1 {
+		t.Fatalf("expected 1 check with fast profile, got %d", len(cfg.Checks))
+	}
+	assertCommand(t, cfg.Checks[0], "go vet ./...", ".")
+
+	cfg, err = New(fsys, WithProfile("full")).Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Checks) != 4 {
+		t.Fatalf("expected 4 checks with full profile, got %d", len(cfg.Checks))
+	}
+	assertCommand(t, cfg.Checks[1], "go test -race ./...", ".")
+	assertCommand(t, cfg.Checks[2], "go test ./...", "api")
+	assertCommand(t, cfg.Checks[3], "govulncheck ./...", ".")
+}
+
+func TestLoad_ProfileNamesUnknownCheck(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`includes:
+  - "api/.qa.yml"
+checks:
+  - name: test
+    run: go test ./...
+profiles:
+  fast:
+    remove:
+      - tset
+      - api-test
+    override:
+      - name: lint
+        run: golangci-lint run --fast
+`),
+		},
+		"api/.qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - name: api-test
+    run: go test ./...
+profiles:
+  fast:
+    remove:
+      - test
+`),
+		},
+	}
+
+	_, err := New(fsys, WithProfile("fast")).Load(".")
+
+	var issues ValidationErrors
+	if !errors.As(err, &issues) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+
+	want := []string{
+		`.qa.yml:9:9: profile fast has no check named "tset" to remove`,
+		`.qa.yml:12:9: profile fast has no check named "lint" to override`,
+		`api/.qa.yml:7:9: profile fast has no check named "test" to remove`,
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("expected %d issues, got %d:\n%v", len(want), len(issues), err)
+	}
+	for i, w := range want {
+		if got := issues[i].Error(); got != w {
+			t.Errorf("issue %d = %q, want %q", i, got, w)
+		}
+	}
+}
+
+func TestLoad_UnknownProfile(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - go vet ./...
+`),
+		},
+	}
+
+	_, err := New(fsys, WithProfile("missing")).Load(".")
+	want := `.qa.yml:1:1: profile "missing" is not defined in any .qa.yml`
+	if err == nil || err.Error() != want {
+		t.Errorf("expected %q, got %v", want, err)
+	}
+}
+
+func TestLoad_Needs(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`includes:
+  - "api/.qa.yml"
+  - "web/.qa.yml"
+`),
+		},
+		"api/.qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - name: generate
+    run: buf generate
+`),
+		},
+		"web/.qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - name: build
+    run: npm run build
+    needs:
+      - generate
+  - name: test
+    run: npm test
+    needs:
+      - build
+      - name: generate
+        dir: ../api
+`),
+		},
+	}
+
+	cfg, err := New(fsys).Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	generate := domain.Ref{WorkingDir: "api", Name: "generate"}
+	build := domain.Ref{WorkingDir: "web", Name: "build"}
+
+	if len(cfg.Checks[1].Needs) != 1 || cfg.Checks[1].Needs[0] != generate {
+		t.Errorf("expected build to need %v, got %v", generate, cfg.Checks[1].Needs)
+	}
+	test := cfg.Checks[2].Needs
+	if len(test) != 2 || test[0] != build || test[1] != generate {
+		t.Errorf("expected test to need %v and %v, got %v", build, generate, test)
+	}
+}
+
+func TestLoad_NeedsUnknownCheck(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - run: npm test
+    needs: [build]
+`),
+		},
+	}
+
+	_, err := New(fsys).Load(".")
+	want := `.qa.yml:2:5: check .:npm test needs "build", which does not exist`
+	if err == nil || err.Error() != want {
+		t.Errorf("expected %q, got %v", want, err)
+	}
+}
+
+func TestLoad_NeedsRemovedCheck(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - name: build
+    run: npm run build
+  - name: e2e
+    run: ./scripts/e2e
+  - name: test
+    run: npm test
+    needs: [build, e2e]
+profiles:
+  fast:
+    remove: [build]
+`),
+		},
+		".qa.local.yml": &fstest.MapFile{
+			Data: []byte(`disable:
+  - e2e
+`),
+		},
+	}
+
+	cfg, err := New(fsys, WithProfile("fast")).Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Checks) != 1 || len(cfg.Checks[0].Needs) != 0 {
+		t.Errorf("expected test without needs, got %v", cfg.Checks)
+	}
+}
+
+func TestLoad_NeedsCycle(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - name: a
+    run: a
+    needs: [b]
+  - name: b
+    run: b
+    needs: [a]
+`),
+		},
+	}
+
+	_, err := New(fsys).Load(".")
+	if err == nil {
+		t.Fatal("expected dependency cycle error")
+	}
+
+	want := ".qa.yml:2:5: dependency cycle detected: .:a -> .:b -> .:a"
+	if err.Error() != want {
+		t.Errorf("expected error %q, got %q", want, err.Error())
+	}
+}
+
+func TestLoad_IncludeTemplateInDir(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`includes:
+  - path: shared/go.qa.yml
+    dir: services/a
+  - path: shared/go.qa.yml
+    dir: services/b
+    env:
+      RACE: -race
+`),
+		},
+		"shared/go.qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - name: build
+    run: go build ./...
+  - name: test
+    run: go test ${RACE:--short} ./...
+    needs: [build]
+`),
+		},
+		"services/a/go.mod": &fstest.MapFile{},
+		"services/b/go.mod": &fstest.MapFile{},
+	}
+
+	cfg, err := New(fsys).Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(cfg.Checks) != 4 {
+		t.Fatalf("expected 4 checks, got %d", len(cfg.Checks))
+	}
+	assertCommand(t, cfg.Checks[0], "go build ./...", "services/a")
+	assertCommand(t, cfg.Checks[1], "go test -short ./...", "services/a")
+	assertCommand(t, cfg.Checks[2], "go build ./...", "services/b")
+	assertCommand(t, cfg.Checks[3], "go test -race ./...", "services/b")
+
+	want := domain.Ref{WorkingDir: "services/b", Name: "build"}
+	if len(cfg.Checks[3].Needs) != 1 || cfg.Checks[3].Needs[0] != want {
+		t.Errorf("expected test to need %v, got %v", want, cfg.Checks[3].Needs)
+	}
+	if got := cfg.Checks[3].Origin.String(); got != "shared/go.qa.yml:4" {
+		t.Errorf("expected origin shared/go.qa.yml:4, got %q", got)
+	}
+}
+
+func TestLoad_IncludeInvalidDir(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`includes:
+  - path: shared/go.qa.yml
+    dir: services/missing
+`),
+		},
+		"shared/go.qa.yml": &fstest.MapFile{Data: []byte("checks:\n  - go test ./...\n")},
+	}
+
+	_, err := New(fsys).Load(".")
+
+	var issues ValidationErrors
+	if !errors.As(err, &issues) || len(issues) != 1 {
+		t.Fatalf("expected one validation error, got %v", err)
+	}
+	if got := issues[0].Error(); got != `.qa.yml:2:5: dir "services/missing" is not a directory` {
+		t.Errorf("unexpected issue %q", got)
+	}
+}
+
+func TestLoadFile_ConfigOutsideRoot(t *testing.T) {
+	fsys := fstest.MapFS{
+		"ci/nightly.yml": &fstest.MapFile{
+			Data: []byte(`includes:
+  - ../api/.qa.yml
+checks:
+  - ./smoke.sh
+`),
+		},
+		"api/.qa.yml": &fstest.MapFile{Data: []byte("checks:\n  - go test ./...\n")},
+	}
+
+	cfg, err := New(fsys).LoadFile("ci/nightly.yml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(cfg.Checks) != 2 {
+		t.Fatalf("expected 2 checks, got %d", len(cfg.Checks))
+	}
+	assertCommand(t, cfg.Checks[0], "./smoke.sh", "ci")
+	assertCommand(t, cfg.Checks[1], "go test ./...", "api")
 }
 
 func assertCommand(t *testing.T, cmd domain.Command, expectedCmd, expectedDir string) {
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"errors"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"strconv"
+
+	"github.com/openark-net/qa/pkg/qa/domain"
+	"gopkg.in/yaml.v3"
+)
+
+const localConfigName = ".qa.local.yml"
+
+// localFile is an uncommitted .qa.local.yml next to a .qa.yml. It adjusts
+// the commands of that file and everything it includes: disabled commands
+// are dropped, replacements swap a named command for another, patches
+// change a few settings of one, and format and check entries are appended.
+// jobs sets the default for --jobs.
+type localFile struct {
+	Format  []entry   `yaml:"format"`
+	Checks  []entry   `yaml:"checks"`
+	Replace []entry   `yaml:"replace"`
+	Patch   []patch   `yaml:"patch"`
+	Disable []located `yaml:"disable"`
+	Jobs    located   `yaml:"jobs"`
+}
+
+// patch adds env vars to, or changes the weight of, the commands matching
+// name without restating them.
+type patch struct {
+	Name   string             `yaml:"name"`
+	Env    map[string]located `yaml:"env"`
+	Weight *int               `yaml:"weight"`
+
+	pos position
+}
+
+func (p *patch) UnmarshalYAML(node *yaml.Node) error {
+	p.pos = positionOf(node)
+	type plain patch
+	return node.Decode((*plain)(p))
+}
+
+func (l *Loader) applyLocal(dir string, sc scope, cfg domain.ConfigSet, state *loadState) (domain.ConfigSet, error) {
+	file := path.Join(dir, localConfigName)
+	data, err := fs.ReadFile(l.fsys, file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return domain.ConfigSet{}, err
+	}
+
+	var local localFile
+	if err := state.decode(file, data, &local); err != nil {
+		return domain.ConfigSet{}, err
+	}
+	o := origin{file: file, via: slices.Clone(state.stack)}
+	local.Format = state.expandMatrix(file, state.validEntries(o, "format", local.Format))
+	local.Checks = state.expandMatrix(file, state.validEntries(o, "check", local.Checks))
+	local.Replace = state.noMatrix(file, "replacement", state.validEntries(o, "replacement", local.Replace))
+	local.Format = state.expandEntries(file, local.Format, sc)
+	local.Checks = state.expandEntries(file, local.Checks, sc)
+	local.Replace = state.expandEntries(file, local.Replace, sc)
+
+	overlay := domain.Overlay{File: file}
+
+	for _, name := range local.Disable {
+		var found bool
+		cfg, found = rewrite(cfg, func(cmd domain.Command) bool {
+			return cmd.Name == name.Value || cmd.DisplayName() == name.Value || cmd.Cmd == name.Value
+		}, func(cmd domain.Command) (domain.Command, bool) {
+			state.removed = append(state.removed, cmd)
+			return cmd, false
+		})
+		if !found {
+			state.report(file, name.pos, "disable: no command named %q", name.Value)
+			continue
+		}
+		overlay.Disabled = append(overlay.Disabled, name.Value)
+	}
+
+	for _, e := range local.Replace {
+		if e.Name == "" {
+			state.report(file, e.pos, "replacement needs the name of the command it replaces")
+			continue
+		}
+		var found bool
+		cfg, found = rewrite(cfg, func(cmd domain.Command) bool {
+			return cmd.Name == e.Name
+		}, func(cmd domain.Command) (domain.Command, bool) {
+			return override(cmd, e, o), true
+		})
+		if !found {
+			state.report(file, e.pos, "replace: no command named %q", e.Name)
+			continue
+		}
+		overlay.Replaced = append(overlay.Replaced, e.Name)
+	}
+
+	for _, p := range local.Patch {
+		if p.Name == "" {
+			state.report(file, p.pos, "patch needs the name of the command it changes")
+			continue
+		}
+		if p.Weight != nil && *p.Weight < 0 {
+			state.report(file, p.pos, "patch %q has negative weight", p.Name)
+			continue
+		}
+		env := make(map[string]string, len(p.Env))
+		for key, value := range p.Env {
+			env[key] = state.interpolate(file, value.pos, value.Value, sc.env)
+		}
+		var found bool
+		cfg, found = rewrite(cfg, func(cmd domain.Command) bool {
+			return cmd.Name == p.Name || cmd.DisplayName() == p.Name || cmd.Cmd == p.Name
+		}, func(cmd domain.Command) (domain.Command, bool) {
+			if len(env) > 0 {
+				cmd.Env = maps.Clone(cmd.Env)
+				if cmd.Env == nil {
+					cmd.Env = make(map[string]string, len(env))
+				}
+				maps.Copy(cmd.Env, env)
+			}
+			if p.Weight != nil {
+				cmd.Weight = *p.Weight
+			}
+			return cmd, true
+		})
+		if !found {
+			state.report(file, p.pos, "patch: no command named %q", p.Name)
+			continue
+		}
+		overlay.Patched = append(overlay.Patched, p.Name)
+	}
+
+	if local.Jobs.Value != "" {
+		jobs, err := strconv.Atoi(local.Jobs.Value)
+		if err != nil || jobs < 1 {
+			state.report(file, local.Jobs.pos, "jobs must be a positive number, got %q", local.Jobs.Value)
+		} else {
+			cfg.Jobs = jobs
+			overlay.Jobs = jobs
+		}
+	}
+
+	for _, e := range local.Format {
+		cmd := e.command(o)
+		cfg.Format[cmd.WorkingDir] = append(cfg.Format[cmd.WorkingDir], cmd)
+		overlay.Added = append(overlay.Added, cmd.DisplayName())
+	}
+	for _, e := range local.Checks {
+		cmd := e.command(o)
+		cfg.Checks = append(cfg.Checks, cmd)
+		overlay.Added = append(overlay.Added, cmd.DisplayName())
+	}
+
+	cfg.Overlays = append(cfg.Overlays, overlay)
+	return cfg, nil
+}
+
+// rewrite replaces every format command and check accepted by match with
+// the result of fn, dropping it when fn returns false. It reports whether
+// any command matched.
+func rewrite(cfg domain.ConfigSet, match func(domain.Command) bool, fn func(domain.Command) (domain.Command, bool)) (domain.ConfigSet, bool) {
+	found := false
+	apply := func(cmds []domain.Command) []domain.Command {
+		var kept []domain.Command
+		for _, cmd := range cmds {
+			if match(cmd) {
+				found = true
+				var keep bool
+				if cmd, keep = fn(cmd); !keep {
+					continue
+				}
+			}
+			kept = append(kept, cmd)
+		}
+		return kept
+	}
+
+	format := make(map[string][]domain.Command, len(cfg.Format))
+	for _, cmds := range cfg.Format {
+		for _, cmd := range apply(cmds) {
+			format[cmd.WorkingDir] = append(format[cmd.WorkingDir], cmd)
+		}
+	}
+	cfg.Format = format
+	cfg.Checks = apply(cfg.Checks)
+	return cfg, found
+}
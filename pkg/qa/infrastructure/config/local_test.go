@@ -0,0 +1,210 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad_LocalOverlay(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`includes:
+  - api/.qa.yml
+format:
+  - go fmt ./...
+checks:
+  - go vet ./...
+`),
+		},
+		".qa.local.yml": &fstest.MapFile{
+			Data: []byte(`disable:
+  - e2e
+replace:
+  - name: test
+    run: go test -short ./...
+checks:
+  - name: lint
+    run: golangci-lint run
+`),
+		},
+		"api/.qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - name: test
+    run: go test ./...
+  - name: e2e
+    run: ./scripts/e2e
+`),
+		},
+	}
+
+	cfg, err := New(fsys).Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(cfg.Checks) != 3 {
+		t.Fatalf("expected 3 checks, got %d: %v", len(cfg.Checks), cfg.Checks)
+	}
+	assertCommand(t, cfg.Checks[0], "go vet ./...", ".")
+	assertCommand(t, cfg.Checks[1], "go test -short ./...", "api")
+	assertCommand(t, cfg.Checks[2], "golangci-lint run", ".")
+
+	if got := cfg.Checks[1].Origin.String(); got != ".qa.local.yml:4" {
+		t.Errorf("expected replacement to come from .qa.local.yml:4, got %q", got)
+	}
+
+	if len(cfg.Overlays) != 1 {
+		t.Fatalf("expected 1 overlay, got %d", len(cfg.Overlays))
+	}
+	overlay := cfg.Overlays[0]
+	if overlay.File != ".qa.local.yml" {
+		t.Errorf("unexpected overlay file %q", overlay.File)
+	}
+	if len(overlay.Disabled) != 1 || overlay.Disabled[0] != "e2e" {
+		t.Errorf("unexpected disabled %v", overlay.Disabled)
+	}
+	if len(overlay.Replaced) != 1 || overlay.Replaced[0] != "test" {
+		t.Errorf("unexpected replaced %v", overlay.Replaced)
+	}
+	if len(overlay.Added) != 1 || overlay.Added[0] != "lint" {
+		t.Errorf("unexpected added %v", overlay.Added)
+	}
+}
+
+func TestLoad_LocalOverlayUnknownNames(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - go vet ./...
+`),
+		},
+		".qa.local.yml": &fstest.MapFile{
+			Data: []byte(`disable:
+  - missing
+replace:
+  - name: absent
+    run: true
+`),
+		},
+	}
+
+	_, err := New(fsys).Load(".")
+
+	var issues ValidationErrors
+	if !errors.As(err, &issues) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+
+	want := []string{
+		`.qa.local.yml:2:5: disable: no command named "missing"`,
+		`.qa.local.yml:4:5: replace: no command named "absent"`,
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("expected %d issues, got %d:\n%v", len(want), len(issues), err)
+	}
+	for i, w := range want {
+		if got := issues[i].Error(); got != w {
+			t.Errorf("issue %d = %q, want %q", i, got, w)
+		}
+	}
+}
+
+func TestLoad_LocalOverlayAppliedOnce(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`includes:
+  - ci.qa.yml
+checks:
+  - go vet ./...
+`),
+		},
+		"ci.qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - go test ./...
+`),
+		},
+		".qa.local.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - golangci-lint run
+`),
+		},
+	}
+
+	cfg, err := New(fsys).Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(cfg.Checks) != 3 {
+		t.Fatalf("expected 3 checks, got %d: %v", len(cfg.Checks), cfg.Checks)
+	}
+	if len(cfg.Overlays) != 1 {
+		t.Errorf("expected 1 overlay, got %d", len(cfg.Overlays))
+	}
+}
+
+func TestLoad_LocalOverlayPatch(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`env:
+  HOME_DIR: /home/dev
+checks:
+  - name: test
+    run: go test ./...
+    env:
+      CGO_ENABLED: "0"
+  - go vet ./...
+`),
+		},
+		".qa.local.yml": &fstest.MapFile{
+			Data: []byte(`jobs: 8
+patch:
+  - name: test
+    env:
+      GOCACHE: ${HOME_DIR}/.gocache
+    weight: 2
+  - name: missing
+    weight: 1
+`),
+		},
+	}
+
+	_, err := New(fsys).Load(".")
+	want := `.qa.local.yml:7:5: patch: no command named "missing"`
+	if err == nil || err.Error() != want {
+		t.Fatalf("expected %q, got %v", want, err)
+	}
+
+	fsys[".qa.local.yml"].Data = []byte(`jobs: 8
+patch:
+  - name: test
+    env:
+      GOCACHE: ${HOME_DIR}/.gocache
+    weight: 2
+`)
+	cfg, err := New(fsys).Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	test := cfg.Checks[0]
+	assertCommand(t, test, "go test ./...", ".")
+	if test.Env["GOCACHE"] != "/home/dev/.gocache" || test.Env["CGO_ENABLED"] != "0" {
+		t.Errorf("expected patched env to extend the check's own, got %v", test.Env)
+	}
+	if test.Weight != 2 {
+		t.Errorf("expected weight 2, got %d", test.Weight)
+	}
+	if cfg.Checks[1].Weight != 0 {
+		t.Errorf("expected unpatched check to keep its weight, got %d", cfg.Checks[1].Weight)
+	}
+	if cfg.Jobs != 8 {
+		t.Errorf("expected jobs 8, got %d", cfg.Jobs)
+	}
+
+	overlay := cfg.Overlays[0]
+	if len(overlay.Patched) != 1 || overlay.Patched[0] != "test" || overlay.Jobs != 8 {
+		t.Errorf("unexpected overlay %+v", overlay)
+	}
+}
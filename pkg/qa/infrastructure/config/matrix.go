@@ -0,0 +1,81 @@
+package config
+
+import (
+	"maps"
+	"slices"
+)
+
+// expandMatrix replaces every entry that has a matrix: with one entry per
+// combination of its values. Each variant gets the combination as env,
+// so the values can be interpolated into its command, and remembers it so
+// the variant has its own name and cache key.
+func (s *loadState) expandMatrix(file string, entries []entry) []entry {
+	var expanded []entry
+	for _, e := range entries {
+		if len(e.Matrix) == 0 {
+			expanded = append(expanded, e)
+			continue
+		}
+		if !s.validMatrix(file, e) {
+			continue
+		}
+
+		for _, variant := range combinations(e.Matrix) {
+			v := e
+			v.Matrix = nil
+			v.variant = variant
+			v.Env = maps.Clone(e.Env)
+			if v.Env == nil {
+				v.Env = make(map[string]string, len(variant))
+			}
+			maps.Copy(v.Env, variant)
+			expanded = append(expanded, v)
+		}
+	}
+	return expanded
+}
+
+func (s *loadState) validMatrix(file string, e entry) bool {
+	valid := true
+	for _, key := range slices.Sorted(maps.Keys(e.Matrix)) {
+		switch {
+		case !isVarName(key):
+			s.report(file, e.pos, "matrix variable %q is not a valid environment variable name", key)
+			valid = false
+		case len(e.Matrix[key]) == 0:
+			s.report(file, e.pos, "matrix variable %s has no values", key)
+			valid = false
+		}
+	}
+	return valid
+}
+
+// combinations returns the cartesian product of matrix, varying the last
+// variable (in key order) fastest so variants list in a stable order.
+func combinations(matrix map[string][]string) []map[string]string {
+	result := []map[string]string{{}}
+	for _, key := range slices.Sorted(maps.Keys(matrix)) {
+		var next []map[string]string
+		for _, partial := range result {
+			for _, value := range matrix[key] {
+				combo := maps.Clone(partial)
+				combo[key] = value
+				next = append(next, combo)
+			}
+		}
+		result = next
+	}
+	return result
+}
+
+// noMatrix drops the matrix: of entries that replace existing commands,
+// which keep the variants of the command they replace instead.
+func (s *loadState) noMatrix(file, kind string, entries []entry) []entry {
+	for i, e := range entries {
+		if len(e.Matrix) > 0 {
+			s.report(file, e.pos, "%s %q cannot have a matrix", kind, e.displayName())
+			entries[i].Matrix = nil
+		}
+	}
+	return entries
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/openark-net/qa/pkg/qa/domain"
+)
+
+func TestLoad_MatrixExpandsVariants(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - name: test
+    run: nvm exec ${NODE} npm test
+    env:
+      CI: "true"
+    matrix:
+      NODE: ["18", "20"]
+      FLAGS: ["", -race]
+  - go vet ./...
+`),
+		},
+	}
+
+	cfg, err := New(fsys, WithLookupEnv(lookupFrom(nil))).Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []struct{ name, cmd string }{
+		{"test (FLAGS=, NODE=18)", "nvm exec 18 npm test"},
+		{"test (FLAGS=, NODE=20)", "nvm exec 20 npm test"},
+		{"test (FLAGS=-race, NODE=18)", "nvm exec 18 npm test"},
+		{"test (FLAGS=-race, NODE=20)", "nvm exec 20 npm test"},
+		{"go vet ./...", "go vet ./..."},
+	}
+	if len(cfg.Checks) != len(want) {
+		t.Fatalf("expected %d checks, got %d", len(want), len(cfg.Checks))
+	}
+
+	keys := make(map[string]bool)
+	for i, w := range want {
+		c := cfg.Checks[i]
+		if c.DisplayName() != w.name || c.Cmd != w.cmd {
+			t.Errorf("check %d: expected %q running %q, got %q running %q", i, w.name, w.cmd, c.DisplayName(), c.Cmd)
+		}
+		if keys[c.ID()] {
+			t.Errorf("check %d: ID %q is not unique", i, c.ID())
+		}
+		keys[c.ID()] = true
+	}
+
+	third := cfg.Checks[2]
+	if third.Env["FLAGS"] != "-race" || third.Env["NODE"] != "18" || third.Env["CI"] != "true" {
+		t.Errorf("expected matrix values and env in variant env, got %v", third.Env)
+	}
+}
+
+func TestLoad_MatrixProfileRemovesAllVariants(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - name: plan
+    run: terraform plan
+    matrix:
+      TF_WORKSPACE: [staging, prod]
+  - go vet ./...
+profiles:
+  fast:
+    remove: [plan]
+`),
+		},
+	}
+
+	cfg, err := New(fsys, WithProfile("fast")).Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Checks) != 1 || cfg.Checks[0].Cmd != "go vet ./..." {
+		t.Errorf("expected only go vet to remain, got %v", cfg.Checks)
+	}
+}
+
+func TestLoad_NeedsMatrixByName(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`includes:
+  - web/.qa.yml
+checks:
+  - name: build
+    run: go build ./...
+    matrix:
+      GOOS: [linux, darwin]
+  - name: package
+    run: ./scripts/package
+    needs: [build, "build (GOOS=linux)"]
+`),
+		},
+		"web/.qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - name: e2e
+    run: npm run e2e
+    needs: [build]
+`),
+		},
+	}
+
+	cfg, err := New(fsys).Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	darwin := domain.Ref{WorkingDir: ".", Name: "build (GOOS=darwin)"}
+	linux := domain.Ref{WorkingDir: ".", Name: "build (GOOS=linux)"}
+	want := map[string][]domain.Ref{
+		"package": {linux, darwin},
+		"e2e":     {linux, darwin},
+	}
+	for _, c := range cfg.Checks {
+		w, ok := want[c.Name]
+		if !ok {
+			continue
+		}
+		if !slices.Equal(c.Needs, w) {
+			t.Errorf("%s: expected needs %v, got %v", c.Name, w, c.Needs)
+		}
+	}
+}
+
+func TestLoad_MatrixInvalid(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - run: make test
+    matrix:
+      MODE: []
+  - run: make lint
+    matrix:
+      not-a-name: [a]
+profiles:
+  ci:
+    override:
+      - name: test
+        run: make test
+        matrix:
+          MODE: [a]
+`),
+		},
+	}
+
+	_, err := New(fsys).Load(".")
+
+	var issues ValidationErrors
+	if !errors.As(err, &issues) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+
+	want := []string{
+		".qa.yml:2:5: matrix variable MODE has no values",
+		".qa.yml:5:5: matrix variable \"not-a-name\" is not a valid environment variable name",
+		".qa.yml:11:9: override \"test\" cannot have a matrix",
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("expected %d issues, got %d:\n%v", len(want), len(issues), issues)
+	}
+	for i, w := range want {
+		if got := issues[i].Error(); got != w {
+			t.Errorf("issue %d: expected %q, got %q", i, w, got)
+		}
+	}
+}
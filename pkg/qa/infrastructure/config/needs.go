@@ -0,0 +1,216 @@
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/openark-net/qa/pkg/qa/domain"
+	"gopkg.in/yaml.v3"
+)
+
+// need is an entry under needs:. It is either the name of a check or a
+// mapping naming a check in another directory, relative to the file.
+type need struct {
+	Name string `yaml:"name" schema:"required"`
+	Dir  string `yaml:"dir"`
+}
+
+func (n *need) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&n.Name)
+	}
+
+	type plain need
+	return node.Decode((*plain)(n))
+}
+
+// ref converts n into a domain.Ref. An unqualified need has an empty
+// WorkingDir until resolveNeeds finds the check it refers to.
+func (n need) ref(fileDir string) domain.Ref {
+	if n.Dir == "" {
+		return domain.Ref{Name: n.Name}
+	}
+	return domain.Ref{WorkingDir: path.Join(fileDir, n.Dir), Name: n.Name}
+}
+
+// resolveNeeds points every need at the checks it names and rejects
+// cycles. An unqualified need prefers a check in the same directory, then a
+// check with that name anywhere as long as there is only one. The name of a
+// matrix check without its variant means every variant. A need on a check
+// a profile or local overlay removed is dropped, the same way the executor
+// treats needs on checks filtered out by tag.
+// Problems are reported at the needing check.
+func (s *loadState) resolveNeeds(checks []domain.Command) []domain.Command {
+	idx := newCheckIndex(checks)
+
+	resolved := make([]domain.Command, len(checks))
+	for i, c := range checks {
+		needs := make([]domain.Ref, 0, len(c.Needs))
+		for _, n := range c.Needs {
+			refs, err := idx.resolve(n, c)
+			if err != nil {
+				s.reportAt(c, "%v", err)
+				continue
+			}
+			if refs == nil && wasRemoved(n, s.removed) {
+				continue
+			}
+			if refs == nil && n.WorkingDir != "" {
+				s.reportAt(c, "check %s needs %s, which does not exist", c.Ref(), n)
+				continue
+			}
+			if refs == nil {
+				s.reportAt(c, "check %s needs %q, which does not exist", c.Ref(), n.Name)
+				continue
+			}
+			for _, ref := range refs {
+				if !slices.Contains(needs, ref) {
+					needs = append(needs, ref)
+				}
+			}
+		}
+		if len(c.Needs) > 0 {
+			c.Needs = needs
+		}
+		resolved[i] = c
+	}
+
+	s.detectCycle(resolved)
+	return resolved
+}
+
+// reportAt records an issue at the entry c was defined by.
+func (s *loadState) reportAt(c domain.Command, format string, args ...any) {
+	s.report(c.Origin.File, position{line: c.Origin.Line, column: c.Origin.Column}, format, args...)
+}
+
+// checkIndex finds checks by name, and matrix checks by the name they
+// share across their variants.
+type checkIndex struct {
+	known    map[domain.Ref]bool
+	byName   map[string][]domain.Ref
+	variants map[domain.Ref][]domain.Ref
+}
+
+func newCheckIndex(checks []domain.Command) checkIndex {
+	idx := checkIndex{
+		known:    make(map[domain.Ref]bool),
+		byName:   make(map[string][]domain.Ref),
+		variants: make(map[domain.Ref][]domain.Ref),
+	}
+	for _, c := range checks {
+		ref := c.Ref()
+		idx.known[ref] = true
+		idx.byName[ref.Name] = append(idx.byName[ref.Name], ref)
+		if len(c.Variant) > 0 {
+			base := baseRef(c)
+			idx.variants[base] = append(idx.variants[base], ref)
+		}
+	}
+	return idx
+}
+
+// resolve returns the checks n, needed by c, refers to, or nil when there
+// are none.
+func (idx checkIndex) resolve(n domain.Ref, c domain.Command) ([]domain.Ref, error) {
+	if n.WorkingDir != "" {
+		return idx.lookup(n), nil
+	}
+
+	if refs := idx.lookup(domain.Ref{WorkingDir: c.WorkingDir, Name: n.Name}); refs != nil {
+		return refs, nil
+	}
+
+	var candidates [][]domain.Ref
+	for _, ref := range idx.byName[n.Name] {
+		candidates = append(candidates, []domain.Ref{ref})
+	}
+	for base, refs := range idx.variants {
+		if base.Name == n.Name && base.WorkingDir != c.WorkingDir {
+			candidates = append(candidates, refs)
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return nil, nil
+	case 1:
+		return candidates[0], nil
+	default:
+		return nil, fmt.Errorf("check %s needs %q, which is ambiguous; add dir: to pick one", c.Ref(), n.Name)
+	}
+}
+
+// lookup returns the check ref names, or every variant of the matrix
+// check it names.
+func (idx checkIndex) lookup(ref domain.Ref) []domain.Ref {
+	if idx.known[ref] {
+		return []domain.Ref{ref}
+	}
+	return idx.variants[ref]
+}
+
+// baseRef is c's ref without its matrix variant.
+func baseRef(c domain.Command) domain.Ref {
+	return domain.Ref{WorkingDir: c.WorkingDir, Name: cmp.Or(c.Name, c.Cmd)}
+}
+
+// wasRemoved reports whether n names a check that was removed, or every
+// variant of one.
+func wasRemoved(n domain.Ref, removed []domain.Command) bool {
+	return slices.ContainsFunc(removed, func(c domain.Command) bool {
+		for _, r := range []domain.Ref{c.Ref(), baseRef(c)} {
+			if r.Name == n.Name && (n.WorkingDir == "" || r.WorkingDir == n.WorkingDir) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// detectCycle reports the first dependency cycle, at the check it starts
+// from.
+func (s *loadState) detectCycle(checks []domain.Command) {
+	needs := make(map[domain.Ref][]domain.Ref, len(checks))
+	for _, c := range checks {
+		needs[c.Ref()] = c.Needs
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := make(map[domain.Ref]int, len(checks))
+	var stack []string
+
+	var visit func(ref domain.Ref) error
+	visit = func(ref domain.Ref) error {
+		switch marks[ref] {
+		case visiting:
+			return fmt.Errorf("dependency cycle detected: %s -> %s", strings.Join(stack, " -> "), ref)
+		case visited:
+			return nil
+		}
+
+		marks[ref] = visiting
+		stack = append(stack, ref.String())
+		for _, dep := range needs[ref] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		marks[ref] = visited
+		return nil
+	}
+
+	for _, c := range checks {
+		if err := visit(c.Ref()); err != nil {
+			s.reportAt(c, "%v", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/openark-net/qa/pkg/qa/domain"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed presets/*.qa.yml
+var presets embed.FS
+
+// presetSpec is an item under preset: or presets:. It is either a preset
+// name or a mapping that also disables or overrides some of the preset's
+// commands by name.
+type presetSpec struct {
+	Name     string    `yaml:"name" schema:"required"`
+	Disable  []located `yaml:"disable"`
+	Override []entry   `yaml:"override"`
+
+	pos position
+}
+
+func (p *presetSpec) UnmarshalYAML(node *yaml.Node) error {
+	defer func() { p.pos = positionOf(node) }()
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&p.Name)
+	}
+
+	type plain presetSpec
+	return node.Decode((*plain)(p))
+}
+
+// Presets returns the names of the built-in presets.
+func Presets() []string {
+	files, _ := fs.Glob(presets, "presets/*.qa.yml")
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = strings.TrimSuffix(path.Base(f), ".qa.yml")
+	}
+	return names
+}
+
+// loadPreset expands a built-in preset into commands that run in the
+// directory of the file using it, with that file's scope. Commands
+// are attributed to the line naming the preset.
+func (s *loadState) loadPreset(spec presetSpec, o origin, sc scope) (domain.ConfigSet, error) {
+	result := domain.ConfigSet{Format: make(map[string][]domain.Command)}
+
+	data, err := presets.ReadFile("presets/" + spec.Name + ".qa.yml")
+	if err != nil {
+		s.report(o.file, spec.pos, "unknown preset %q, expected one of %s", spec.Name, strings.Join(Presets(), ", "))
+		return result, nil
+	}
+
+	var file qaFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return domain.ConfigSet{}, fmt.Errorf("parsing preset %s: %w", spec.Name, err)
+	}
+
+	attribute := func(e entry) domain.Command {
+		cmd := e.command(o)
+		cmd.Origin.Line = spec.pos.line
+		cmd.Origin.Column = spec.pos.column
+		cmd.Origin.Preset = spec.Name
+		return cmd
+	}
+	for _, e := range s.expandEntries(o.file, file.Format, sc) {
+		cmd := attribute(e)
+		result.Format[cmd.WorkingDir] = append(result.Format[cmd.WorkingDir], cmd)
+	}
+	for _, e := range s.expandEntries(o.file, file.Checks, sc) {
+		result.Checks = append(result.Checks, attribute(e))
+	}
+
+	for _, name := range spec.Disable {
+		var found bool
+		result, found = rewrite(result, func(cmd domain.Command) bool {
+			return cmd.Name == name.Value
+		}, func(cmd domain.Command) (domain.Command, bool) {
+			return cmd, false
+		})
+		if !found {
+			s.report(o.file, name.pos, "preset %s has no command named %q", spec.Name, name.Value)
+		}
+	}
+
+	overrides := s.expandEntries(o.file, s.noMatrix(o.file, "override", s.validEntries(o, "override", spec.Override)), sc)
+	for _, e := range overrides {
+		if e.Name == "" {
+			s.report(o.file, e.pos, "override needs the name of the preset command it replaces")
+			continue
+		}
+		var found bool
+		result, found = rewrite(result, func(cmd domain.Command) bool {
+			return cmd.Name == e.Name
+		}, func(cmd domain.Command) (domain.Command, bool) {
+			return override(cmd, e, o), true
+		})
+		if !found {
+			s.report(o.file, e.pos, "preset %s has no command named %q", spec.Name, e.Name)
+		}
+	}
+	return result, nil
+}
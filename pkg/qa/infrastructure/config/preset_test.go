@@ -0,0 +1,111 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPresets_AllLoad(t *testing.T) {
+	names := Presets()
+	if len(names) == 0 {
+		t.Fatal("expected built-in presets")
+	}
+
+	for _, name := range names {
+		fsys := fstest.MapFS{
+			".qa.yml": &fstest.MapFile{Data: []byte("preset: " + name + "\n")},
+		}
+
+		cfg, err := New(fsys).Load(".")
+		if err != nil {
+			t.Errorf("preset %s: unexpected error: %v", name, err)
+			continue
+		}
+		if len(cfg.Checks) == 0 {
+			t.Errorf("preset %s: expected checks", name)
+		}
+		for _, cmd := range append(cfg.Format["."], cfg.Checks...) {
+			if cmd.Name == "" {
+				t.Errorf("preset %s: command %q has no name to disable it by", name, cmd.Cmd)
+			}
+		}
+	}
+}
+
+func TestLoad_PresetDisableAndOverride(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`includes:
+  - api/.qa.yml
+`),
+		},
+		"api/.qa.yml": &fstest.MapFile{
+			Data: []byte(`presets:
+  - name: go
+    disable: [go build]
+    override:
+      - name: go test
+        run: go test -race ./...
+checks:
+  - ./scripts/smoke
+`),
+		},
+	}
+
+	cfg, err := New(fsys).Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(cfg.Format["api"]) != 1 {
+		t.Fatalf("expected the preset's format command in api, got %v", cfg.Format)
+	}
+	assertCommand(t, cfg.Format["api"][0], "go fmt ./...", "api")
+
+	if len(cfg.Checks) != 3 {
+		t.Fatalf("expected 3 checks, got %d: %v", len(cfg.Checks), cfg.Checks)
+	}
+	assertCommand(t, cfg.Checks[0], "go vet ./...", "api")
+	assertCommand(t, cfg.Checks[1], "go test -race ./...", "api")
+	assertCommand(t, cfg.Checks[2], "./scripts/smoke", "api")
+
+	if got := cfg.Checks[0].Origin.String(); got != "api/.qa.yml:2 (preset go)" {
+		t.Errorf("expected preset origin, got %q", got)
+	}
+	if got := cfg.Checks[1].Origin.String(); got != "api/.qa.yml:5" {
+		t.Errorf("expected override origin api/.qa.yml:5, got %q", got)
+	}
+}
+
+func TestLoad_PresetUnknown(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`presets:
+  - golang
+  - name: rust
+    disable: [cargo bench]
+`),
+		},
+	}
+
+	_, err := New(fsys).Load(".")
+
+	var issues ValidationErrors
+	if !errors.As(err, &issues) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+
+	want := []string{
+		`.qa.yml:2:5: unknown preset "golang", expected one of go, node-npm, python-ruff, rust, terraform`,
+		`.qa.yml:4:15: preset rust has no command named "cargo bench"`,
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("expected %d issues, got %d:\n%v", len(want), len(issues), issues)
+	}
+	for i, w := range want {
+		if got := issues[i].Error(); got != w {
+			t.Errorf("issue %d: expected %q, got %q", i, w, got)
+		}
+	}
+}
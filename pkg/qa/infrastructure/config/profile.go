@@ -0,0 +1,97 @@
+package config
+
+import (
+	"maps"
+
+	"github.com/openark-net/qa/pkg/qa/domain"
+)
+
+// profile adjusts the checks of the file declaring it and everything that
+// file includes. Profiles with the same name in different files are all
+// applied, innermost first, so a parent can still adjust what a child's
+// profile produced.
+type profile struct {
+	Add      []entry   `yaml:"add"`
+	Remove   []located `yaml:"remove"`
+	Override []entry   `yaml:"override"`
+}
+
+// apply adjusts checks, which come from the file declaring the profile and
+// its includes. Names in remove or override that match none of them are
+// reported, since a typo would otherwise leave the profile doing nothing.
+func (p profile) apply(name string, checks []domain.Command, o origin, state *loadState) []domain.Command {
+	matched := make(map[string]bool, len(p.Remove)+len(p.Override))
+	removed := make(map[string]bool, len(p.Remove))
+	for _, r := range p.Remove {
+		removed[r.Value] = true
+	}
+
+	overrides := make(map[string]entry, len(p.Override))
+	for _, e := range p.Override {
+		if e.Name == "" {
+			state.report(o.file, e.pos, "override of %q has no name", e.Run)
+			continue
+		}
+		overrides[e.Name] = e
+	}
+
+	var result []domain.Command
+	for _, cmd := range checks {
+		if r := removedAs(removed, cmd); r != "" {
+			matched[r] = true
+			state.removed = append(state.removed, cmd)
+			continue
+		}
+		if e, ok := overrides[cmd.Name]; ok {
+			matched[cmd.Name] = true
+			cmd = override(cmd, e, o)
+		}
+		result = append(result, cmd)
+	}
+
+	for _, r := range p.Remove {
+		if !matched[r.Value] {
+			state.report(o.file, r.pos, "profile %s has no check named %q to remove", name, r.Value)
+		}
+	}
+	for _, e := range p.Override {
+		if e.Name != "" && !matched[e.Name] {
+			state.report(o.file, e.pos, "profile %s has no check named %q to override", name, e.Name)
+		}
+	}
+
+	for _, e := range p.Add {
+		result = append(result, e.command(o))
+	}
+	return result
+}
+
+// removedAs returns the name in removed that cmd is listed under, checking
+// its name, display name and command in turn, or "" when it is kept.
+func removedAs(removed map[string]bool, cmd domain.Command) string {
+	for _, n := range []string{cmd.Name, cmd.DisplayName(), cmd.Cmd} {
+		if n != "" && removed[n] {
+			return n
+		}
+	}
+	return ""
+}
+
+// override replaces cmd with e, keeping cmd's working directory unless e
+// sets its own. Overriding a matrix check overrides each variant, which
+// keeps its matrix values in its env.
+func override(cmd domain.Command, e entry, o origin) domain.Command {
+	replaced := e.command(o)
+	if e.Dir == "" {
+		replaced.WorkingDir = cmd.WorkingDir
+	}
+	if len(cmd.Variant) > 0 {
+		replaced.Variant = cmd.Variant
+		replaced.Env = maps.Clone(replaced.Env)
+		if replaced.Env == nil {
+			replaced.Env = make(map[string]string, len(cmd.Variant))
+		}
+		maps.Copy(replaced.Env, cmd.Variant)
+	}
+	return replaced
+}
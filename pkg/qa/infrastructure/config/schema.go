@@ -0,0 +1,127 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const schemaID = "https://raw.githubusercontent.com/openark-net/qa/main/qa.schema.json"
+
+var (
+	durationType    = reflect.TypeOf(time.Duration(0))
+	unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+)
+
+// Schema returns the JSON Schema for .qa.yml, derived from the structs the
+// loader decodes into so the two cannot drift apart.
+func Schema() ([]byte, error) {
+	g := schemaGenerator{defs: make(map[string]any)}
+	root := g.object(reflect.TypeOf(qaFile{}))
+	root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	root["$id"] = schemaID
+	root["title"] = ".qa.yml"
+	root["$defs"] = g.defs
+
+	data, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+type schemaGenerator struct {
+	defs map[string]any
+}
+
+func (g schemaGenerator) schema(t reflect.Type) map[string]any {
+	if t == durationType {
+		return map[string]any{
+			"type":    "string",
+			"pattern": `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`,
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.String:
+		return scalar()
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		return g.ref(t)
+	}
+	return map[string]any{}
+}
+
+// scalar describes a string. YAML decodes any scalar into a Go string, so
+// env: {PORT: 5432} and matrix: {NODE: [18, 20]} load as "5432", "18" and
+// "20", and the schema accepts numbers and booleans there too.
+func scalar() map[string]any {
+	return map[string]any{"type": []any{"string", "number", "boolean"}}
+}
+
+// ref returns a reference to the definition of struct type t, adding the
+// definition on first use. Types with their own UnmarshalYAML also accept a
+// bare scalar, or are only a scalar when they have no yaml fields.
+func (g schemaGenerator) ref(t reflect.Type) map[string]any {
+	name := strings.ToLower(t.Name()[:1]) + t.Name()[1:]
+	if _, ok := g.defs[name]; !ok {
+		g.defs[name] = nil
+
+		var def map[string]any
+		switch {
+		case !reflect.PointerTo(t).Implements(unmarshalerType):
+			def = g.object(t)
+		case len(yamlFields(t)) == 0:
+			def = scalar()
+		default:
+			def = map[string]any{
+				"oneOf": []any{
+					scalar(),
+					g.object(t),
+				},
+			}
+		}
+		g.defs[name] = def
+	}
+	return map[string]any{"$ref": "#/$defs/" + name}
+}
+
+// object describes struct type t. Fields tagged schema:"required" must be
+// present.
+func (g schemaGenerator) object(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		properties[name] = g.schema(f.Type)
+		if f.Tag.Get("schema") == "required" {
+			required = append(required, name)
+		}
+	}
+
+	obj := map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		obj["required"] = required
+	}
+	return obj
+}
@@ -0,0 +1,191 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestSchema_MatchesPublishedFile(t *testing.T) {
+	schema, err := Schema()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	published, err := os.ReadFile("../../../../qa.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(schema) != string(published) {
+		t.Error("qa.schema.json is out of date; run go generate from the repository root")
+	}
+}
+
+func TestSchema_DescribesConfigKeys(t *testing.T) {
+	schema, err := Schema()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var doc struct {
+		Properties map[string]any `json:"properties"`
+		Defs       map[string]any `json:"$defs"`
+	}
+	if err := json.Unmarshal(schema, &doc); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+
+	for _, key := range []string{"includes", "discover", "exclude", "format", "checks", "profiles"} {
+		if _, ok := doc.Properties[key]; !ok {
+			t.Errorf("schema is missing top-level key %q", key)
+		}
+	}
+	for _, def := range []string{"entry", "need", "profile", "inputs", "when", "located"} {
+		if _, ok := doc.Defs[def]; !ok {
+			t.Errorf("schema is missing definition %q", def)
+		}
+	}
+}
+
+func TestSchema_AcceptsNumericScalars(t *testing.T) {
+	config := `checks:
+  - name: db
+    run: go test ./...
+    env:
+      PORT: 5432
+      DEBUG: true
+    matrix:
+      NODE: [18, 20.5]
+`
+
+	if err := validateAgainstSchema(t, config); err != nil {
+		t.Errorf("schema rejects config the loader accepts: %v", err)
+	}
+
+	cfg, err := New(fstest.MapFS{".qa.yml": &fstest.MapFile{Data: []byte(config)}}).Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Checks) != 2 || cfg.Checks[0].Env["PORT"] != "5432" || cfg.Checks[0].Env["DEBUG"] != "true" {
+		t.Errorf("expected both variants with PORT=5432 and DEBUG=true, got %v", cfg.Checks)
+	}
+}
+
+func TestSchema_RejectsNonScalarEnv(t *testing.T) {
+	err := validateAgainstSchema(t, `checks:
+  - run: go test ./...
+    env:
+      PORT: [5432]
+`)
+	if err == nil {
+		t.Error("expected a list env value to be rejected")
+	}
+}
+
+// validateAgainstSchema checks a YAML document against the generated
+// schema, covering the keywords Schema emits.
+func validateAgainstSchema(t *testing.T, doc string) error {
+	t.Helper()
+	data, err := Schema()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+	var value any
+	if err := yaml.Unmarshal([]byte(doc), &value); err != nil {
+		t.Fatalf("invalid YAML: %v", err)
+	}
+	return validateValue(schema["$defs"].(map[string]any), schema, value, "$")
+}
+
+func validateValue(defs, s map[string]any, v any, at string) error {
+	if ref, ok := s["$ref"].(string); ok {
+		return validateValue(defs, defs[strings.TrimPrefix(ref, "#/$defs/")].(map[string]any), v, at)
+	}
+	if oneOf, ok := s["oneOf"].([]any); ok {
+		var matches int
+		for _, option := range oneOf {
+			if validateValue(defs, option.(map[string]any), v, at) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fmt.Errorf("%s matches %d of oneOf", at, matches)
+		}
+		return nil
+	}
+
+	if want, ok := s["type"]; ok {
+		types, ok := want.([]any)
+		if !ok {
+			types = []any{want}
+		}
+		if !slices.ContainsFunc(types, func(typ any) bool { return hasType(v, typ.(string)) }) {
+			return fmt.Errorf("%s: %v is not %v", at, v, want)
+		}
+	}
+	if pattern, ok := s["pattern"].(string); ok {
+		if str, _ := v.(string); !regexp.MustCompile(pattern).MatchString(str) {
+			return fmt.Errorf("%s: %q does not match %s", at, str, pattern)
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		required, _ := s["required"].([]any)
+		for _, key := range required {
+			if _, ok := v[key.(string)]; !ok {
+				return fmt.Errorf("%s: missing %s", at, key)
+			}
+		}
+		properties, _ := s["properties"].(map[string]any)
+		for key, item := range v {
+			sub, ok := properties[key].(map[string]any)
+			if !ok {
+				sub, ok = s["additionalProperties"].(map[string]any)
+			}
+			if !ok {
+				return fmt.Errorf("%s: unexpected key %s", at, key)
+			}
+			if err := validateValue(defs, sub, item, at+"."+key); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for i, item := range v {
+			if err := validateValue(defs, s["items"].(map[string]any), item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func hasType(v any, typ string) bool {
+	switch v.(type) {
+	case string:
+		return typ == "string"
+	case bool:
+		return typ == "boolean"
+	case int:
+		return typ == "integer" || typ == "number"
+	case float64:
+		return typ == "number"
+	case map[string]any:
+		return typ == "object"
+	case []any:
+		return typ == "array"
+	}
+	return false
+}
@@ -0,0 +1,250 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad_ReportsValidationErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`includes:
+  - api/.qa.yml
+  - missing/.qa.yml
+check:
+  - go vet ./...
+`),
+		},
+		"api/.qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - go test ./...
+  - ""
+  - name: lint
+    runn: golangci-lint run
+  - go test ./...
+profiles:
+  fast:
+    remvoe: [lint]
+`),
+		},
+	}
+
+	_, err := New(fsys).Load(".")
+
+	var issues ValidationErrors
+	if !errors.As(err, &issues) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+
+	want := []string{
+		`.qa.yml:3:5: included file missing/.qa.yml not found`,
+		`.qa.yml:4:1: unknown key "check", did you mean "checks"?`,
+		`api/.qa.yml:3:5: check has an empty command`,
+		`api/.qa.yml:4:5: check has an empty command`,
+		`api/.qa.yml:5:5: unknown key "runn", did you mean "run"?`,
+		`api/.qa.yml:6:5: duplicate check "go test ./...", first defined at line 2`,
+		`api/.qa.yml:9:5: unknown key "remvoe", did you mean "remove"?`,
+	}
+
+	if len(issues) != len(want) {
+		t.Fatalf("expected %d issues, got %d:\n%v", len(want), len(issues), err)
+	}
+	for i, w := range want {
+		if got := issues[i].Error(); got != w {
+			t.Errorf("issue %d = %q, want %q", i, got, w)
+		}
+	}
+}
+
+func TestLoad_DuplicateChecksAcrossFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`preset: go
+includes:
+  - ci.qa.yml
+checks:
+  - "true"
+  - name: go test
+    run: go test -race ./...
+`),
+		},
+		"ci.qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - "true"
+`),
+		},
+	}
+
+	_, err := New(fsys).Load(".")
+
+	var issues ValidationErrors
+	if !errors.As(err, &issues) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+
+	want := []string{
+		`.qa.yml:6:5: duplicate check "go test" in ., first defined at .qa.yml:1 (preset go)`,
+		`ci.qa.yml:2:5: duplicate check "true" in ., first defined at .qa.yml:5`,
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("expected %d issues, got %d:\n%v", len(want), len(issues), err)
+	}
+	for i, w := range want {
+		if got := issues[i].Error(); got != w {
+			t.Errorf("issue %d = %q, want %q", i, got, w)
+		}
+	}
+}
+
+func TestLoad_UnknownKeyWithoutSuggestion(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`whatever: true
+`),
+		},
+	}
+
+	_, err := New(fsys).Load(".")
+	if err == nil || err.Error() != `.qa.yml:1:1: unknown key "whatever"` {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLoad_RejectsCheckOnlyFieldsOnFormat(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`format:
+  - run: gofmt -w .
+    needs: [lint]
+  - run: prettier --write .
+    inputs:
+      include: ["**/*.ts"]
+  - run: buf format -w
+    external_inputs: [proto]
+  - run: go mod tidy
+    tags: [deps]
+checks:
+  - name: lint
+    run: golangci-lint run
+`),
+		},
+	}
+
+	_, err := New(fsys).Load(".")
+
+	var issues ValidationErrors
+	if !errors.As(err, &issues) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+
+	want := []string{
+		`.qa.yml:2:5: format "gofmt -w ." cannot set needs, which only applies to checks`,
+		`.qa.yml:4:5: format "prettier --write ." cannot set inputs, which only applies to checks`,
+		`.qa.yml:7:5: format "buf format -w" cannot set external_inputs, which only applies to checks`,
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("expected %d issues, got %d:\n%v", len(want), len(issues), err)
+	}
+	for i, w := range want {
+		if got := issues[i].Error(); got != w {
+			t.Errorf("issue %d = %q, want %q", i, got, w)
+		}
+	}
+}
+
+func TestLoad_ValidatesDirOverride(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`includes:
+  - tools/.qa.yml
+checks:
+  - run: cargo test
+    dir: crates/core
+  - run: cargo test
+    dir: crates/missing
+  - run: cargo test
+    dir: Cargo.toml
+`),
+		},
+		"tools/.qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - run: ls
+    dir: ../..
+  - run: ls
+    dir: /etc
+`),
+		},
+		"Cargo.toml":             &fstest.MapFile{},
+		"crates/core/Cargo.toml": &fstest.MapFile{},
+	}
+
+	cfg, err := New(fsys).Load(".")
+
+	var issues ValidationErrors
+	if !errors.As(err, &issues) {
+		t.Fatalf("expected ValidationErrors, got %v (%v)", err, cfg)
+	}
+
+	want := []string{
+		`.qa.yml:6:5: dir "crates/missing" is not a directory`,
+		`.qa.yml:8:5: dir "Cargo.toml" is not a directory`,
+		`tools/.qa.yml:2:5: dir "../.." is outside the repository`,
+		`tools/.qa.yml:4:5: dir "/etc" must be relative to the config file`,
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("expected %d issues, got %d:\n%v", len(want), len(issues), err)
+	}
+	for i, w := range want {
+		if got := issues[i].Error(); got != w {
+			t.Errorf("issue %d = %q, want %q", i, got, w)
+		}
+	}
+}
+
+func TestLoad_DirOverrideSetsWorkingDir(t *testing.T) {
+	fsys := fstest.MapFS{
+		".qa.yml": &fstest.MapFile{
+			Data: []byte(`format:
+  - run: cargo fmt
+    dir: crates/core
+checks:
+  - run: cargo test
+    dir: crates/core
+`),
+		},
+		"crates/core/Cargo.toml": &fstest.MapFile{},
+	}
+
+	cfg, err := New(fsys).Load(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(cfg.Format["crates/core"]) != 1 {
+		t.Errorf("expected format command keyed by crates/core, got %v", cfg.Format)
+	}
+	assertCommand(t, cfg.Checks[0], "cargo test", "crates/core")
+}
+
+func TestLoadFile_DirOutsideConfigDirectory(t *testing.T) {
+	fsys := fstest.MapFS{
+		"ci/.qa.yml": &fstest.MapFile{
+			Data: []byte(`checks:
+  - run: go test ./...
+    dir: ../modules/core
+`),
+		},
+		"modules/core/go.mod": &fstest.MapFile{},
+	}
+
+	cfg, err := New(fsys).LoadFile("ci/.qa.yml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(cfg.Checks) != 1 {
+		t.Fatalf("expected 1 check, got %d", len(cfg.Checks))
+	}
+	assertCommand(t, cfg.Checks[0], "go test ./...", "modules/core")
+}
@@ -0,0 +1,67 @@
+// Package glob matches slash-separated paths against patterns. It follows
+// path.Match for each segment and adds "**", which spans zero or more
+// directories.
+package glob
+
+import (
+	"path"
+	"strings"
+)
+
+// HasMeta reports whether pattern contains any glob metacharacters.
+func HasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
+
+// Match reports whether name matches pattern. Malformed patterns never match.
+func Match(pattern, name string) bool {
+	return matchSegments(split(pattern), split(name))
+}
+
+// Base returns the longest leading directory of pattern that contains no
+// metacharacters, which is where a walk for matches should start.
+func Base(pattern string) string {
+	var base []string
+	for _, seg := range split(pattern) {
+		if HasMeta(seg) {
+			break
+		}
+		base = append(base, seg)
+	}
+	if len(base) == 0 {
+		return "."
+	}
+	return path.Join(base...)
+}
+
+func split(p string) []string {
+	p = path.Clean(p)
+	if p == "." {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,47 @@
+package glob
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"services/*/.qa.yml", "services/api/.qa.yml", true},
+		{"services/*/.qa.yml", "services/api/nested/.qa.yml", false},
+		{"**/.qa.yml", ".qa.yml", true},
+		{"**/.qa.yml", "a/b/c/.qa.yml", true},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "pkg/x/main.go", true},
+		{"**/*.go", "pkg/x/README.md", false},
+		{"vendor/**", "vendor", true},
+		{"vendor/**", "vendor/a/b.go", true},
+		{"vendor/**", "src/vendor/a.go", false},
+		{"docs/**/*.md", "docs/a/b/c.md", true},
+		{"docs/**/*.md", "src/a.md", false},
+		{"./api/*.go", "api/main.go", true},
+		{"[", "[", false},
+	}
+
+	for _, c := range cases {
+		if got := Match(c.pattern, c.name); got != c.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", c.pattern, c.name, got, c.want)
+		}
+	}
+}
+
+func TestBase(t *testing.T) {
+	cases := map[string]string{
+		"services/*/.qa.yml": "services",
+		"**/.qa.yml":         ".",
+		"a/b/c.txt":          "a/b/c.txt",
+		"a/b?/c":             "a",
+	}
+
+	for pattern, want := range cases {
+		if got := Base(pattern); got != want {
+			t.Errorf("Base(%q) = %q, want %q", pattern, got, want)
+		}
+	}
+}
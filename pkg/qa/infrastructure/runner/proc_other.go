@@ -0,0 +1,19 @@
+//go:build !unix
+
+package runner
+
+import (
+	"os"
+	"os/exec"
+)
+
+// Without process groups only the shell itself can be stopped, and it is
+// killed at once.
+
+func setProcessGroup(*exec.Cmd) {}
+
+func terminate(p *os.Process) error {
+	return p.Kill()
+}
+
+func kill(*os.Process) {}
@@ -3,33 +3,98 @@ package runner
 import (
 	"bytes"
 	"context"
+	"errors"
+	"os"
 	"os/exec"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/openark-net/qa/pkg/qa/domain"
 )
 
-type Runner struct{}
+// DefaultGracePeriod is how long a stopped command has to exit after
+// SIGTERM before it is killed.
+const DefaultGracePeriod = 5 * time.Second
 
-func New() *Runner {
-	return &Runner{}
+type Runner struct {
+	grace time.Duration
 }
 
-// NOTE: Hardcoded to sh. Will break on Windows.
-func (r *Runner) Run(ctx context.Context, cmd domain.Command) domain.CommandResult {
-	shellCmd := exec.CommandContext(ctx, "sh", "-c", cmd.Cmd)
+type Option func(*Runner)
+
+// WithGracePeriod sets how long a stopped command has to exit after
+// SIGTERM before it and everything it started is killed.
+func WithGracePeriod(d time.Duration) Option {
+	return func(r *Runner) {
+		r.grace = d
+	}
+}
+
+func New(opts ...Option) *Runner {
+	r := &Runner{grace: DefaultGracePeriod}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run runs cmd in its own process group. When ctx is done, or cmd.Timeout
+// passes, the group gets SIGTERM and, after the grace period, SIGKILL, so
+// processes the shell started do not outlive it. A command stopped by its
+// own timeout is TimedOut and keeps the output it printed so far; one
+// stopped by ctx fails, and the caller knows why.
+//
+// NOTE: Defaults to sh. Will break on Windows.
+func (r *Runner) Run(parent context.Context, cmd domain.Command) domain.CommandResult {
+	ctx := parent
+	if cmd.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cmd.Timeout)
+		defer cancel()
+	}
+
+	args := []string{"sh"}
+	if shell := strings.Fields(cmd.Shell); len(shell) > 0 {
+		args = shell
+	}
+	args = append(args, "-c", cmd.Cmd)
+
+	shellCmd := exec.CommandContext(ctx, args[0], args[1:]...)
 	shellCmd.Dir = cmd.WorkingDir
+	setProcessGroup(shellCmd)
+	shellCmd.Cancel = func() error { return terminate(shellCmd.Process) }
+	shellCmd.WaitDelay = r.grace
+	if len(cmd.Env) > 0 {
+		shellCmd.Env = append(os.Environ(), environ(cmd.Env)...)
+	}
 
 	var output bytes.Buffer
 	shellCmd.Stdout = &output
 	shellCmd.Stderr = &output
 
 	err := shellCmd.Run()
+	if ctx.Err() != nil && shellCmd.Process != nil {
+		// Whatever ignored SIGTERM or kept the output open is still running.
+		kill(shellCmd.Process)
+	}
 
 	result := domain.CommandResult{
 		Command: cmd,
 		Output:  output.String(),
 	}
 
+	if err != nil && parent.Err() == nil && ctx.Err() != nil {
+		result.State = domain.TimedOut
+		result.ExitCode = -1
+		return result
+	}
+	if errors.Is(err, exec.ErrWaitDelay) && shellCmd.ProcessState.Success() {
+		// The shell succeeded but left something running that holds the
+		// output open; it was cut off after the grace period.
+		err = nil
+	}
+
 	if err != nil {
 		result.State = domain.Failed
 		if exitErr, ok := err.(*exec.ExitError); ok {
@@ -44,3 +109,17 @@ func (r *Runner) Run(ctx context.Context, cmd domain.Command) domain.CommandResu
 	result.ExitCode = 0
 	return result
 }
+
+func environ(env map[string]string) []string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	vars := make([]string, 0, len(keys))
+	for _, k := range keys {
+		vars = append(vars, k+"="+env[k])
+	}
+	return vars
+}
@@ -2,6 +2,9 @@ package runner_test
 
 import (
 	"context"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -28,7 +31,7 @@ func TestRunner_Run_Success(t *testing.T) {
 	if got := strings.TrimSpace(result.Output); got != "hello" {
 		t.Errorf("Output = %q, want %q", got, "hello")
 	}
-	if result.Command != cmd {
+	if !reflect.DeepEqual(result.Command, cmd) {
 		t.Errorf("Command not preserved in result")
 	}
 }
@@ -67,6 +70,39 @@ func TestRunner_Run_RespectsWorkingDir(t *testing.T) {
 	}
 }
 
+func TestRunner_Run_AppliesEnv(t *testing.T) {
+	r := runner.New()
+	cmd := domain.Command{
+		Cmd:        "echo $QA_GREETING",
+		WorkingDir: "/tmp",
+		Env:        map[string]string{"QA_GREETING": "hi"},
+	}
+
+	result := r.Run(context.Background(), cmd)
+
+	if result.State != domain.Completed {
+		t.Errorf("State = %v, want Completed", result.State)
+	}
+	if got := strings.TrimSpace(result.Output); got != "hi" {
+		t.Errorf("Output = %q, want %q", got, "hi")
+	}
+}
+
+func TestRunner_Run_UsesShell(t *testing.T) {
+	r := runner.New()
+	cmd := domain.Command{
+		Cmd:        "set -o pipefail; false | true",
+		WorkingDir: "/tmp",
+		Shell:      "bash -e",
+	}
+
+	result := r.Run(context.Background(), cmd)
+
+	if result.State != domain.Failed {
+		t.Errorf("State = %v, want Failed from pipefail under bash", result.State)
+	}
+}
+
 func TestRunner_Run_Failure(t *testing.T) {
 	r := runner.New()
 	cmd := domain.Command{
@@ -105,3 +141,90 @@ func TestRunner_Run_ContextCancellation(t *testing.T) {
 		t.Errorf("Command took %v, expected cancellation within 1s", elapsed)
 	}
 }
+
+func TestRunner_Run_TimeoutKeepsPartialOutput(t *testing.T) {
+	r := runner.New()
+	cmd := domain.Command{
+		Cmd:        "echo started; sleep 10",
+		WorkingDir: "/tmp",
+		Timeout:    100 * time.Millisecond,
+	}
+
+	start := time.Now()
+	result := r.Run(context.Background(), cmd)
+	elapsed := time.Since(start)
+
+	if result.State != domain.TimedOut {
+		t.Errorf("State = %v, want TimedOut", result.State)
+	}
+	if got := strings.TrimSpace(result.Output); got != "started" {
+		t.Errorf("Output = %q, want %q", got, "started")
+	}
+	if elapsed > time.Second {
+		t.Errorf("Command took %v, expected it stopped within 1s", elapsed)
+	}
+}
+
+func TestRunner_Run_TimeoutKillsProcessGroup(t *testing.T) {
+	r := runner.New()
+	marker := filepath.Join(t.TempDir(), "survived")
+	cmd := domain.Command{
+		Cmd:        "(sleep 0.5; touch " + marker + ") & wait",
+		WorkingDir: "/tmp",
+		Timeout:    100 * time.Millisecond,
+	}
+
+	result := r.Run(context.Background(), cmd)
+	if result.State != domain.TimedOut {
+		t.Errorf("State = %v, want TimedOut", result.State)
+	}
+
+	time.Sleep(time.Second)
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("background process outlived the timed-out command")
+	}
+}
+
+func TestRunner_Run_KillsAfterGracePeriod(t *testing.T) {
+	r := runner.New(runner.WithGracePeriod(200 * time.Millisecond))
+	cmd := domain.Command{
+		Cmd:        "trap '' TERM; sleep 10",
+		WorkingDir: "/tmp",
+		Timeout:    100 * time.Millisecond,
+	}
+
+	start := time.Now()
+	result := r.Run(context.Background(), cmd)
+	elapsed := time.Since(start)
+
+	if result.State != domain.TimedOut {
+		t.Errorf("State = %v, want TimedOut", result.State)
+	}
+	if elapsed < 300*time.Millisecond {
+		t.Errorf("Command took %v, expected it to get the grace period", elapsed)
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("Command took %v, expected SIGKILL after the grace period", elapsed)
+	}
+}
+
+func TestRunner_Run_CancelKillsProcessGroup(t *testing.T) {
+	r := runner.New()
+	marker := filepath.Join(t.TempDir(), "survived")
+	cmd := domain.Command{
+		Cmd:        "sh -c 'sleep 0.5; touch " + marker + "'",
+		WorkingDir: "/tmp",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	result := r.Run(ctx, cmd)
+	if result.State != domain.Failed {
+		t.Errorf("State = %v, want Failed", result.State)
+	}
+
+	time.Sleep(time.Second)
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("grandchild process outlived the cancelled command")
+	}
+}
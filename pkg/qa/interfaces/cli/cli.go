@@ -1,15 +1,23 @@
 package cli
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/openark-net/qa/pkg/qa/application"
 	"github.com/openark-net/qa/pkg/qa/domain"
 	"github.com/openark-net/qa/pkg/qa/infrastructure/cache"
+	"github.com/openark-net/qa/pkg/qa/infrastructure/condition"
 	"github.com/openark-net/qa/pkg/qa/infrastructure/config"
 	"github.com/openark-net/qa/pkg/qa/infrastructure/runner"
 	"github.com/openark-net/qa/pkg/qa/interfaces/presenter"
@@ -18,6 +26,11 @@ import (
 func Command() *cobra.Command {
 	var noCache bool
 	var cacheDir string
+	var tags, skipTags []string
+	var verbose bool
+	var jobs int
+	var failFast bool
+	var timeout time.Duration
 
 	cmd := &cobra.Command{
 		Use:   "qa",
@@ -28,34 +41,59 @@ Checks are cached using git tree hashes—unchanged code is skipped.
 Format commands run sequentially, then checks run in parallel.
 
 Configuration (.qa.yml):
+  preset:   Built-in commands for go, node-npm, terraform,
+            python-ruff or rust; presets: for several
   format:   Commands to run before checks (e.g., formatters)
   checks:   Commands to run in parallel with caching
-  includes: Paths to other .qa.yml files to compose`,
+            Entries are a command string or a mapping with
+            name, run, env, timeout, shell, retries, weight, locks,
+            dir, needs, when, tags and matrix
+  includes: Paths or globs of other .qa.yml files to compose, or a
+            mapping with path, dir and env to run a shared file
+            in another directory
+  discover: Include every .qa.yml below the file
+  exclude:  Globs skipped by glob includes and discovery
+  defaults: timeout, shell, retries, tags and env for every
+            command, inherited by includes
+  env:      Variables for every command, inherited by includes
+  env_file: A dotenv file loaded before env:
+  profiles: Named sets of checks to add, remove or override,
+            selected with --profile or QA_PROFILE
+
+An uncommitted .qa.local.yml next to any .qa.yml can disable, replace
+or add commands for the local machine; --verbose lists its changes.
+
+Commands and env values may use ${VAR} and ${VAR:-default}; they are
+resolved when the configuration loads. Write $${VAR} to pass ${VAR} to
+the shell.`,
 		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cwd, err := os.Getwd()
-			if err != nil {
-				return err
+			if jobs < 1 {
+				return fmt.Errorf("--jobs must be at least 1, got %d", jobs)
+			}
+			if timeout < 0 {
+				return fmt.Errorf("--timeout must not be negative, got %s", timeout)
 			}
 
-			configDir, err := config.FindConfig(cwd)
+			cfg, configDir, err := loadConfig(cmd)
 			if err != nil {
 				return err
 			}
 
-			loader := config.New(os.DirFS(configDir))
-			cfg, err := loader.Load(".")
-			if err != nil {
-				return err
+			if verbose {
+				presenter.PrintOverlays(cfg.Overlays, configDir)
+			}
+			if cfg.Jobs > 0 && !cmd.Flags().Changed("jobs") {
+				jobs = cfg.Jobs
 			}
 
-			cfg = resolveWorkingDirs(cfg, configDir)
+			cfg, excluded := application.FilterByTags(cfg, tags, skipTags)
 
 			var c domain.Cache
 			if noCache {
 				c = cache.NoOp{}
 			} else {
-				realCache, err := cache.New(cmd.Context(), cacheDir)
+				realCache, err := cache.New(cmd.Context(), cacheDir, configDir)
 				if err != nil {
 					c = cache.NoOp{}
 				} else {
@@ -63,15 +101,42 @@ Configuration (.qa.yml):
 				}
 			}
 
+			var git condition.Git
+			if client, err := cache.NewGitClient(cmd.Context(), configDir); err == nil {
+				git = client
+			}
+
 			cmdRunner := runner.New()
-			executor := application.New(cmdRunner, c)
-			pres := presenter.New(presenter.NewDirColumn(cfg, configDir))
+			opts := []application.Option{
+				application.WithConditions(condition.New(cmd.Context(), git)),
+				application.WithJobs(jobs),
+			}
+			if failFast {
+				opts = append(opts, application.WithFailFast())
+			}
+			executor := application.New(cmdRunner, c, opts...)
+			pres := presenter.New(presenter.NewDirColumn(cfg, configDir), presenter.WithExcluded(excluded))
 
 			go pres.Run(executor.Events())
 
-			success := executor.Run(cmd.Context(), cfg)
+			// Commands run in their own process groups, out of reach of the
+			// terminal's Ctrl-C, so qa stops them itself.
+			interrupt, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			ctx := interrupt
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+
+			success := executor.Run(ctx, cfg)
 			pres.Wait()
 
+			if interrupt.Err() != nil {
+				return errors.New("interrupted")
+			}
 			if !success {
 				return errors.New("checks failed")
 			}
@@ -81,6 +146,16 @@ Configuration (.qa.yml):
 
 	cmd.Flags().BoolVar(&noCache, "no-cache", false, "Skip cache, run all checks")
 	cmd.Flags().StringVar(&cacheDir, "cache-dir", defaultCacheDir(), "Cache directory")
+	cmd.Flags().IntVarP(&jobs, "jobs", "j", runtime.NumCPU(), "Job slots for running commands; a check with weight: n takes n")
+	cmd.Flags().DurationVar(&timeout, "timeout", 0, "Stop the run after this long, e.g. 10m; checks still running time out")
+	cmd.Flags().BoolVar(&failFast, "fail-fast", false, "Cancel the remaining checks as soon as one fails")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Show settings that come from local .qa.local.yml overlays")
+	cmd.Flags().StringSliceVar(&tags, "tag", nil, "Only run commands with one of these tags")
+	cmd.Flags().StringSliceVar(&skipTags, "skip-tag", nil, "Skip commands with any of these tags")
+	cmd.PersistentFlags().String("profile", os.Getenv("QA_PROFILE"), "Profile to apply (env: QA_PROFILE)")
+	cmd.PersistentFlags().String("config", os.Getenv("QA_CONFIG"), "Config file or directory to use instead of the nearest .qa.yml (env: QA_CONFIG)")
+
+	cmd.AddCommand(validateCommand(), configCommand())
 
 	return cmd
 }
@@ -92,6 +167,70 @@ func Run() int {
 	return 0
 }
 
+// loadConfig loads the config chosen with --config, or else the nearest
+// .qa.yml above the working directory, along with everything it includes,
+// applying the --profile selected on cmd. Either way the config is loaded
+// from the enclosing repository, so dir: and include: paths may reach
+// outside the config file's own directory. It returns that root. Working
+// directories in the result are absolute.
+func loadConfig(cmd *cobra.Command) (domain.ConfigSet, string, error) {
+	profile, err := cmd.Flags().GetString("profile")
+	if err != nil {
+		return domain.ConfigSet{}, "", err
+	}
+	configPath, err := cmd.Flags().GetString("config")
+	if err != nil {
+		return domain.ConfigSet{}, "", err
+	}
+
+	if configPath == "" {
+		var cwd string
+		if cwd, err = os.Getwd(); err == nil {
+			configPath, err = config.FindConfig(cwd)
+		}
+		if err != nil {
+			return domain.ConfigSet{}, "", err
+		}
+	}
+	configDir, configFile, err := config.ResolveConfig(configPath)
+	if err != nil {
+		return domain.ConfigSet{}, "", err
+	}
+
+	opts := []config.Option{config.WithProfile(profile)}
+	if ignored := gitIgnored(cmd.Context(), configDir); ignored != nil {
+		opts = append(opts, config.WithIgnored(ignored))
+	}
+	cfg, err := config.New(os.DirFS(configDir), opts...).LoadFile(configFile)
+	if err != nil {
+		return domain.ConfigSet{}, "", err
+	}
+	return resolveWorkingDirs(cfg, configDir), configDir, nil
+}
+
+// gitIgnored reports which paths below root git ignores, so discovery does
+// not descend into dependencies and build output. It returns nil outside a
+// git repository.
+func gitIgnored(ctx context.Context, root string) func(string) bool {
+	git, err := cache.NewGitClient(ctx, root)
+	if err != nil {
+		return nil
+	}
+	paths, err := git.IgnoredPaths(ctx)
+	if err != nil {
+		return nil
+	}
+
+	ignored := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		ignored[strings.TrimSuffix(p, "/")] = true
+	}
+	return func(p string) bool {
+		rel, err := git.ToRelative(filepath.Join(root, filepath.FromSlash(p)))
+		return err == nil && ignored[filepath.ToSlash(rel)]
+	}
+}
+
 func defaultCacheDir() string {
 	home, err := os.UserHomeDir()
 	if err != nil {
@@ -108,19 +247,46 @@ func resolveWorkingDirs(cfg domain.ConfigSet, baseDir string) domain.ConfigSet {
 	for dir, cmds := range cfg.Format {
 		absDir := filepath.Join(baseDir, dir)
 		for _, cmd := range cmds {
-			resolved.Format[absDir] = append(resolved.Format[absDir], domain.Command{
-				Cmd:        cmd.Cmd,
-				WorkingDir: absDir,
-			})
+			resolved.Format[absDir] = append(resolved.Format[absDir], resolveCommand(cmd, baseDir))
 		}
 	}
 
 	for _, cmd := range cfg.Checks {
-		resolved.Checks = append(resolved.Checks, domain.Command{
-			Cmd:        cmd.Cmd,
-			WorkingDir: filepath.Join(baseDir, cmd.WorkingDir),
-		})
+		resolved.Checks = append(resolved.Checks, resolveCommand(cmd, baseDir))
 	}
 
+	for _, overlay := range cfg.Overlays {
+		overlay.File = filepath.Join(baseDir, overlay.File)
+		resolved.Overlays = append(resolved.Overlays, overlay)
+	}
+	resolved.Jobs = cfg.Jobs
+
 	return resolved
 }
+
+// resolveCommand makes every path the loader produced relative to the
+// config root absolute.
+func resolveCommand(cmd domain.Command, baseDir string) domain.Command {
+	cmd.WorkingDir = filepath.Join(baseDir, cmd.WorkingDir)
+
+	if len(cmd.Needs) > 0 {
+		needs := make([]domain.Ref, len(cmd.Needs))
+		for i, ref := range cmd.Needs {
+			needs[i] = domain.Ref{WorkingDir: filepath.Join(baseDir, ref.WorkingDir), Name: ref.Name}
+		}
+		cmd.Needs = needs
+	}
+
+	if cmd.Origin.File != "" {
+		cmd.Origin.File = filepath.Join(baseDir, cmd.Origin.File)
+	}
+	if len(cmd.Origin.Via) > 0 {
+		via := make([]string, len(cmd.Origin.Via))
+		for i, file := range cmd.Origin.Via {
+			via[i] = filepath.Join(baseDir, file)
+		}
+		cmd.Origin.Via = via
+	}
+
+	return cmd
+}
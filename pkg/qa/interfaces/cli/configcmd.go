@@ -0,0 +1,270 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/openark-net/qa/pkg/qa/domain"
+)
+
+func configCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the resolved configuration",
+	}
+
+	cmd.AddCommand(configPrintCommand(), configWhichCommand())
+	return cmd
+}
+
+func configPrintCommand() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "print",
+		Short: "Print the fully merged configuration",
+		Long: `print loads the nearest .qa.yml with all of its includes and prints
+the commands qa would run, each with its absolute working directory and
+the file and line that defined it.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, configDir, err := loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+			return writeConfig(cmd.OutOrStdout(), newConfigView(cfg, configDir), format)
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "f", "yaml", "Output format: yaml or json")
+	return cmd
+}
+
+func configWhichCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "which <pattern>",
+		Short: "Show where matching commands are defined",
+		Long: `which lists every command whose name or command string contains the
+pattern, or matches it as a whole when the pattern has * or ? wildcards,
+along with the file and line that defined it and the chain of includes
+that led there.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+
+			matches := 0
+			for _, c := range allCommands(cfg) {
+				if !matchesPattern(args[0], c) {
+					continue
+				}
+				matches++
+				printOrigin(cmd.OutOrStdout(), c)
+			}
+
+			if matches == 0 {
+				return fmt.Errorf("no command matches %q", args[0])
+			}
+			return nil
+		},
+	}
+}
+
+// configView is the printable form of a domain.ConfigSet.
+type configView struct {
+	Root     string        `yaml:"root" json:"root"`
+	Format   []commandView `yaml:"format,omitempty" json:"format,omitempty"`
+	Checks   []commandView `yaml:"checks,omitempty" json:"checks,omitempty"`
+	Overlays []overlayView `yaml:"local_overlays,omitempty" json:"local_overlays,omitempty"`
+}
+
+type overlayView struct {
+	File     string   `yaml:"file" json:"file"`
+	Added    []string `yaml:"added,omitempty" json:"added,omitempty"`
+	Replaced []string `yaml:"replaced,omitempty" json:"replaced,omitempty"`
+	Patched  []string `yaml:"patched,omitempty" json:"patched,omitempty"`
+	Disabled []string `yaml:"disabled,omitempty" json:"disabled,omitempty"`
+	Jobs     int      `yaml:"jobs,omitempty" json:"jobs,omitempty"`
+}
+
+type commandView struct {
+	Name           string            `yaml:"name,omitempty" json:"name,omitempty"`
+	Run            string            `yaml:"run" json:"run"`
+	Dir            string            `yaml:"dir" json:"dir"`
+	Source         string            `yaml:"source" json:"source"`
+	Via            []string          `yaml:"via,omitempty" json:"via,omitempty"`
+	Env            map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+	Timeout        string            `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	Shell          string            `yaml:"shell,omitempty" json:"shell,omitempty"`
+	Retries        int               `yaml:"retries,omitempty" json:"retries,omitempty"`
+	Weight         int               `yaml:"weight,omitempty" json:"weight,omitempty"`
+	Locks          []string          `yaml:"locks,omitempty" json:"locks,omitempty"`
+	Inputs         *inputsView       `yaml:"inputs,omitempty" json:"inputs,omitempty"`
+	ExternalInputs []string          `yaml:"external_inputs,omitempty" json:"external_inputs,omitempty"`
+	Needs          []string          `yaml:"needs,omitempty" json:"needs,omitempty"`
+	When           *whenView         `yaml:"when,omitempty" json:"when,omitempty"`
+	Tags           []string          `yaml:"tags,omitempty" json:"tags,omitempty"`
+	Variant        map[string]string `yaml:"variant,omitempty" json:"variant,omitempty"`
+}
+
+type whenView struct {
+	Changed []string          `yaml:"changed,omitempty" json:"changed,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+	Branch  []string          `yaml:"branch,omitempty" json:"branch,omitempty"`
+}
+
+type inputsView struct {
+	Include []string `yaml:"include,omitempty" json:"include,omitempty"`
+	Exclude []string `yaml:"exclude,omitempty" json:"exclude,omitempty"`
+}
+
+func newConfigView(cfg domain.ConfigSet, root string) configView {
+	view := configView{Root: root}
+
+	dirs := make([]string, 0, len(cfg.Format))
+	for dir := range cfg.Format {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		for _, c := range cfg.Format[dir] {
+			view.Format = append(view.Format, newCommandView(c))
+		}
+	}
+	for _, c := range cfg.Checks {
+		view.Checks = append(view.Checks, newCommandView(c))
+	}
+	for _, o := range cfg.Overlays {
+		view.Overlays = append(view.Overlays, overlayView(o))
+	}
+	return view
+}
+
+func newCommandView(c domain.Command) commandView {
+	view := commandView{
+		Name:           c.Name,
+		Run:            c.Cmd,
+		Dir:            c.WorkingDir,
+		Source:         c.Origin.String(),
+		Via:            c.Origin.Via,
+		Env:            c.Env,
+		Shell:          c.Shell,
+		Retries:        c.Retries,
+		Weight:         c.Weight,
+		Locks:          c.Locks,
+		ExternalInputs: c.ExternalInputs,
+		Tags:           c.Tags,
+		Variant:        c.Variant,
+	}
+	if c.Timeout > 0 {
+		view.Timeout = c.Timeout.String()
+	}
+	if !c.Inputs.IsZero() {
+		view.Inputs = &inputsView{Include: c.Inputs.Include, Exclude: c.Inputs.Exclude}
+	}
+	for _, ref := range c.Needs {
+		view.Needs = append(view.Needs, ref.String())
+	}
+	if !c.When.IsZero() {
+		view.When = &whenView{Changed: c.When.Changed, Env: c.When.Env, Branch: c.When.Branch}
+	}
+	return view
+}
+
+func writeConfig(w io.Writer, view configView, format string) error {
+	switch format {
+	case "yaml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(view); err != nil {
+			return err
+		}
+		return enc.Close()
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(view)
+	default:
+		return fmt.Errorf("unknown format %q, expected yaml or json", format)
+	}
+}
+
+func allCommands(cfg domain.ConfigSet) []domain.Command {
+	dirs := make([]string, 0, len(cfg.Format))
+	for dir := range cfg.Format {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	var cmds []domain.Command
+	for _, dir := range dirs {
+		cmds = append(cmds, cfg.Format[dir]...)
+	}
+	return append(cmds, cfg.Checks...)
+}
+
+// matchesPattern reports whether c's name or command contains pattern or,
+// when pattern has wildcards, matches it as a whole.
+func matchesPattern(pattern string, c domain.Command) bool {
+	wildcard := strings.ContainsAny(pattern, "*?")
+	for _, s := range []string{c.Name, c.Cmd} {
+		if s == "" {
+			continue
+		}
+		if wildcard && matchWildcard(pattern, s) || !wildcard && strings.Contains(s, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchWildcard reports whether s matches pattern, where * matches any run
+// of characters and ? any single one. Commands are plain strings rather than
+// paths, so both match slashes too.
+func matchWildcard(pattern, s string) bool {
+	p, r := []rune(pattern), []rune(s)
+	i, j := 0, 0
+	star, next := -1, 0
+	for j < len(r) {
+		switch {
+		case i < len(p) && p[i] == '*':
+			star, next = i, j
+			i++
+		case i < len(p) && (p[i] == '?' || p[i] == r[j]):
+			i++
+			j++
+		case star >= 0:
+			next++
+			i, j = star+1, next
+		default:
+			return false
+		}
+	}
+	for i < len(p) && p[i] == '*' {
+		i++
+	}
+	return i == len(p)
+}
+
+func printOrigin(w io.Writer, c domain.Command) {
+	fmt.Fprintln(w, c.DisplayName())
+	if c.Name != "" || len(c.Variant) > 0 {
+		fmt.Fprintf(w, "  run:        %s\n", c.Cmd)
+	}
+	fmt.Fprintf(w, "  dir:        %s\n", c.WorkingDir)
+	fmt.Fprintf(w, "  defined at: %s\n", c.Origin)
+	if len(c.Origin.Via) > 0 {
+		fmt.Fprintf(w, "  via:        %s\n", strings.Join(c.Origin.Via, " -> "))
+	}
+}
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/openark-net/qa/pkg/qa/domain"
+)
+
+func TestMatchesPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		cmd     domain.Command
+		want    bool
+	}{
+		{"vet", domain.Command{Cmd: "go vet ./..."}, true},
+		{"lint", domain.Command{Cmd: "go vet ./..."}, false},
+		{"go test*", domain.Command{Cmd: "go test ./pkg/..."}, true},
+		{"*./pkg/*", domain.Command{Cmd: "go test ./pkg/qa/..."}, true},
+		{"go*", domain.Command{Cmd: "npm test -- go"}, false},
+		{"*go", domain.Command{Cmd: "npm test -- go"}, true},
+		{"go ve?", domain.Command{Cmd: "go vet"}, true},
+		{"go ve?", domain.Command{Cmd: "go vet ./..."}, false},
+		{"a?b", domain.Command{Cmd: "a/b"}, true},
+		{"**", domain.Command{Cmd: ""}, false},
+		{"unit", domain.Command{Name: "unit-tests", Cmd: "go test ./..."}, true},
+		{"unit*", domain.Command{Name: "unit-tests", Cmd: "go test ./..."}, true},
+		{"go test*", domain.Command{Name: "unit-tests", Cmd: "go test ./..."}, true},
+		{"*-tests", domain.Command{Name: "unit", Cmd: "go test ./... # e2e-tests"}, true},
+		{"[unit]", domain.Command{Name: "[unit] go"}, true},
+	}
+
+	for _, tt := range tests {
+		if got := matchesPattern(tt.pattern, tt.cmd); got != tt.want {
+			t.Errorf("matchesPattern(%q, %q/%q) = %v, want %v", tt.pattern, tt.cmd.Name, tt.cmd.Cmd, got, tt.want)
+		}
+	}
+}
+
+func TestNewConfigView(t *testing.T) {
+	cfg := domain.ConfigSet{
+		Format: map[string][]domain.Command{
+			"/repo/web": {{Cmd: "prettier --write .", WorkingDir: "/repo/web"}},
+			"/repo":     {{Cmd: "gofmt -w .", WorkingDir: "/repo"}},
+		},
+		Checks: []domain.Command{
+			{
+				Name:       "test",
+				Cmd:        "go test ./...",
+				WorkingDir: "/repo",
+				Timeout:    2 * time.Minute,
+				Needs:      []domain.Ref{{WorkingDir: "/repo", Name: "generate"}},
+				Origin:     domain.Origin{File: ".qa.yml", Line: 4, Via: []string{"ci.qa.yml"}},
+			},
+		},
+		Overlays: []domain.Overlay{{File: ".qa.local.yml", Disabled: []string{"lint"}}},
+	}
+
+	view := newConfigView(cfg, "/repo")
+
+	if view.Root != "/repo" {
+		t.Errorf("Root = %q, want /repo", view.Root)
+	}
+	if len(view.Format) != 2 || view.Format[0].Run != "gofmt -w ." || view.Format[1].Run != "prettier --write ." {
+		t.Errorf("expected format commands sorted by directory, got %+v", view.Format)
+	}
+	if len(view.Checks) != 1 {
+		t.Fatalf("expected 1 check, got %d", len(view.Checks))
+	}
+	check := view.Checks[0]
+	if check.Source != ".qa.yml:4" || check.Timeout != "2m0s" || len(check.Via) != 1 {
+		t.Errorf("unexpected check view %+v", check)
+	}
+	if len(check.Needs) != 1 || check.Needs[0] != (domain.Ref{WorkingDir: "/repo", Name: "generate"}).String() {
+		t.Errorf("unexpected needs %v", check.Needs)
+	}
+	if check.Inputs != nil || check.When != nil {
+		t.Errorf("expected unset inputs and when to be omitted, got %+v", check)
+	}
+	if len(view.Overlays) != 1 || view.Overlays[0].Disabled[0] != "lint" {
+		t.Errorf("unexpected overlays %+v", view.Overlays)
+	}
+}
+
+func TestWriteConfig(t *testing.T) {
+	view := configView{
+		Root:   "/repo",
+		Checks: []commandView{{Run: "go vet ./...", Dir: "/repo", Source: ".qa.yml:2"}},
+	}
+
+	var buf bytes.Buffer
+	if err := writeConfig(&buf, view, "yaml"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `root: /repo
+checks:
+  - run: go vet ./...
+    dir: /repo
+    source: .qa.yml:2
+`
+	if buf.String() != want {
+		t.Errorf("yaml output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := writeConfig(&buf, view, "json"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded configView
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("json output is not valid: %v", err)
+	}
+	if decoded.Root != "/repo" || len(decoded.Checks) != 1 || decoded.Checks[0].Run != "go vet ./..." {
+		t.Errorf("unexpected json round trip %+v", decoded)
+	}
+
+	if err := writeConfig(&buf, view, "toml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
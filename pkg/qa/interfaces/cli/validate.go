@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/openark-net/qa/pkg/qa/infrastructure/config"
+)
+
+func validateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate",
+		Short: "Check .qa.yml files for errors",
+		Long: `validate loads the nearest .qa.yml, or the one chosen with --config,
+and everything it includes, and reports unknown keys, empty commands,
+missing includes, duplicate checks, unknown needs and dependency cycles
+as file:line:column. The same checks run before every qa run.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := loadConfig(cmd)
+
+			var issues config.ValidationErrors
+			if errors.As(err, &issues) {
+				for _, issue := range issues {
+					fmt.Fprintln(cmd.ErrOrStderr(), issue)
+				}
+				return fmt.Errorf("%d problem(s) found", len(issues))
+			}
+			if err != nil {
+				return err
+			}
+
+			formats := 0
+			for _, cmds := range cfg.Format {
+				formats += len(cmds)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "configuration is valid: %d format command(s), %d check(s)\n", formats, len(cfg.Checks))
+			return nil
+		},
+	}
+}
@@ -1,7 +1,9 @@
 package presenter
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/pterm/pterm"
@@ -16,16 +18,46 @@ type Presenter struct {
 	multi      *pterm.MultiPrinter
 	spinners   map[string]*pterm.SpinnerPrinter
 	startTimes map[string]time.Time
-	done       chan struct{}
+	lockWaits  map[string]time.Duration
+	tally      tally
+	// interrupted labels the commands stopped while running.
+	interrupted []string
+	done        chan struct{}
 }
 
-func New(dirs DirColumn) *Presenter {
-	return &Presenter{
+// tally counts command outcomes for the summary line.
+type tally struct {
+	passed    int
+	failed    int
+	cached    int
+	skipped   int
+	timedOut  int
+	cancelled int
+	excluded  int
+}
+
+type Option func(*Presenter)
+
+// WithExcluded reports in the summary how many commands were filtered out
+// before the run.
+func WithExcluded(n int) Option {
+	return func(p *Presenter) {
+		p.tally.excluded = n
+	}
+}
+
+func New(dirs DirColumn, opts ...Option) *Presenter {
+	p := &Presenter{
 		dirs:       dirs,
 		spinners:   make(map[string]*pterm.SpinnerPrinter),
 		startTimes: make(map[string]time.Time),
+		lockWaits:  make(map[string]time.Duration),
 		done:       make(chan struct{}),
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
 }
 
 func (p *Presenter) Run(events <-chan domain.Event) {
@@ -34,16 +66,21 @@ func (p *Presenter) Run(events <-chan domain.Event) {
 
 	for event := range events {
 		switch e := event.(type) {
+		case domain.CommandQueued:
+			p.handleQueued(e)
 		case domain.CommandStarted:
 			p.handleStart(e)
 		case domain.CommandFinished:
 			p.handleFinish(e)
 		case domain.CommandCached:
 			p.handleCached(e)
+		case domain.CommandSkipped:
+			p.handleSkipped(e)
 		}
 	}
 
 	p.multi.Stop()
+	p.printSummary()
 	close(p.done)
 }
 
@@ -51,16 +88,49 @@ func (p *Presenter) Wait() {
 	<-p.done
 }
 
+// handleQueued shows a command waiting for a lock or job slots as a dimmed
+// spinner, which handleStart turns into a regular one.
+func (p *Presenter) handleQueued(e domain.CommandQueued) {
+	text := fmt.Sprintf("%s%s (queued: %s)", p.dirs.Prefix(e.Command.WorkingDir), e.Command.DisplayName(), e.Reason)
+	if spinner := p.spinners[e.Command.ID()]; spinner != nil {
+		spinner.UpdateText(text)
+		return
+	}
+
+	spinner, _ := pterm.DefaultSpinner.
+		WithWriter(p.multi.NewWriter()).
+		WithMessageStyle(pterm.NewStyle(pterm.FgGray)).
+		Start(text)
+	p.spinners[e.Command.ID()] = spinner
+	p.startTimes[e.Command.ID()] = time.Now()
+}
+
 func (p *Presenter) handleStart(e domain.CommandStarted) {
+	if e.LockWait > 0 {
+		p.lockWaits[e.Command.ID()] = e.LockWait
+	}
+	if spinner := p.spinners[e.Command.ID()]; spinner != nil {
+		spinner.MessageStyle = pterm.DefaultSpinner.MessageStyle
+		spinner.ResetTimer()
+		spinner.UpdateText(p.dirs.Prefix(e.Command.WorkingDir) + e.Command.DisplayName())
+		p.startTimes[e.Command.ID()] = time.Now()
+		return
+	}
+
 	spinner, _ := pterm.DefaultSpinner.
 		WithWriter(p.multi.NewWriter()).
 		WithShowTimer(true).
-		Start(p.dirs.Prefix(e.Command.WorkingDir) + e.Command.Cmd)
+		Start(p.dirs.Prefix(e.Command.WorkingDir) + e.Command.DisplayName())
 	p.spinners[e.Command.ID()] = spinner
 	p.startTimes[e.Command.ID()] = time.Now()
 }
 
 func (p *Presenter) handleFinish(e domain.CommandFinished) {
+	if e.Result.State == domain.Cancelled {
+		p.handleCancelled(e.Result)
+		return
+	}
+
 	cmdID := e.Result.Command.ID()
 	spinner := p.spinners[cmdID]
 	if spinner == nil {
@@ -69,13 +139,29 @@ func (p *Presenter) handleFinish(e domain.CommandFinished) {
 
 	duration := time.Since(p.startTimes[cmdID])
 	prefix := p.dirs.Prefix(e.Result.Command.WorkingDir)
-	message := prefix + p.formatCompletionMessage(e.Result.Command.Cmd, duration)
+	label := e.Result.Command.DisplayName()
+	if e.Result.Attempts > 1 {
+		label = fmt.Sprintf("%s (attempt %d/%d)", label, e.Result.Attempts, e.Result.Command.Retries+1)
+	}
+	if e.Result.State == domain.TimedOut {
+		label += " (timed out)"
+	}
+	message := prefix + p.formatCompletionMessage(label, duration)
+	if wait, ok := p.lockWaits[cmdID]; ok && wait >= durationDisplayThreshold {
+		message += pterm.FgGray.Sprintf(" (waited %s for locks)", formatDuration(wait))
+	}
 
 	if e.Result.State == domain.Completed {
+		p.tally.passed++
 		spinner.MessageStyle = pterm.NewStyle(pterm.FgGreen)
 		spinner.SuccessPrinter = &pterm.PrefixPrinter{Prefix: pterm.Prefix{Text: "✓", Style: pterm.NewStyle(pterm.FgGreen)}}
 		spinner.Success(message)
 	} else {
+		if e.Result.State == domain.TimedOut {
+			p.tally.timedOut++
+		} else {
+			p.tally.failed++
+		}
 		spinner.MessageStyle = pterm.NewStyle(pterm.FgRed)
 		spinner.FailPrinter = &pterm.PrefixPrinter{Prefix: pterm.Prefix{Text: "✗", Style: pterm.NewStyle(pterm.FgRed)}}
 		spinner.Fail(message)
@@ -83,14 +169,53 @@ func (p *Presenter) handleFinish(e domain.CommandFinished) {
 	}
 	delete(p.spinners, cmdID)
 	delete(p.startTimes, cmdID)
+	delete(p.lockWaits, cmdID)
 }
 
-func (p *Presenter) formatCompletionMessage(cmd string, duration time.Duration) string {
+// handleCancelled reports a command stopped or never started because the
+// run was cancelled, without its output, which says nothing about the code.
+// Commands cut short by fail-fast say so; commands that were running when
+// the run was interrupted are listed again after the summary.
+func (p *Presenter) handleCancelled(result domain.CommandResult) {
+	cmd := result.Command
+	label := p.dirs.Prefix(cmd.WorkingDir) + cmd.DisplayName()
+	state := "cancelled"
+	switch {
+	case errors.Is(result.Cause, domain.ErrFailFast):
+		state = "cancelled: " + domain.ErrFailFast.Error()
+		p.tally.cancelled++
+	case result.Attempts > 0:
+		state = "interrupted"
+		p.interrupted = append(p.interrupted, label)
+	default:
+		p.tally.cancelled++
+	}
+	gray := pterm.NewStyle(pterm.FgGray)
+	message := fmt.Sprintf("%s (%s)", label, state)
+
+	if spinner := p.spinners[cmd.ID()]; spinner != nil {
+		spinner.MessageStyle = gray
+		spinner.WarningPrinter = &pterm.PrefixPrinter{Prefix: pterm.Prefix{Text: "⊘", Style: gray}}
+		spinner.Warning(message)
+		delete(p.spinners, cmd.ID())
+		delete(p.startTimes, cmd.ID())
+		delete(p.lockWaits, cmd.ID())
+		return
+	}
+
+	printer := pterm.PrefixPrinter{
+		MessageStyle: gray,
+		Prefix:       pterm.Prefix{Text: "⊘", Style: gray},
+	}
+	fmt.Fprint(p.multi.NewWriter(), printer.Sprintln(message))
+}
+
+func (p *Presenter) formatCompletionMessage(label string, duration time.Duration) string {
 	if duration < durationDisplayThreshold {
-		return cmd
+		return label
 	}
 	durationText := pterm.FgGray.Sprint(formatDuration(duration))
-	return fmt.Sprintf("%s %s", cmd, durationText)
+	return fmt.Sprintf("%s %s", label, durationText)
 }
 
 func formatDuration(d time.Duration) string {
@@ -104,6 +229,7 @@ func formatDuration(d time.Duration) string {
 }
 
 func (p *Presenter) handleCached(e domain.CommandCached) {
+	p.tally.cached++
 	gray := pterm.NewStyle(pterm.FgGray)
 	printer := pterm.PrefixPrinter{
 		MessageStyle: gray,
@@ -111,7 +237,22 @@ func (p *Presenter) handleCached(e domain.CommandCached) {
 	}
 
 	prefix := p.dirs.Prefix(e.Command.WorkingDir)
-	message := fmt.Sprintf("%s%s (cached)", prefix, e.Command.Cmd)
+	message := fmt.Sprintf("%s%s (cached)", prefix, e.Command.DisplayName())
+
+	writer := p.multi.NewWriter()
+	fmt.Fprint(writer, printer.Sprintln(message))
+}
+
+func (p *Presenter) handleSkipped(e domain.CommandSkipped) {
+	p.tally.skipped++
+	yellow := pterm.NewStyle(pterm.FgYellow)
+	printer := pterm.PrefixPrinter{
+		MessageStyle: yellow,
+		Prefix:       pterm.Prefix{Text: "↷", Style: yellow},
+	}
+
+	prefix := p.dirs.Prefix(e.Command.WorkingDir)
+	message := fmt.Sprintf("%s%s (skipped: %s)", prefix, e.Command.DisplayName(), e.Reason)
 
 	writer := p.multi.NewWriter()
 	fmt.Fprint(writer, printer.Sprintln(message))
@@ -124,3 +265,61 @@ func (p *Presenter) printFailureOutput(result domain.CommandResult) {
 	pterm.Println()
 	pterm.FgRed.Println(result.Output)
 }
+
+func (p *Presenter) printSummary() {
+	parts := []struct {
+		count int
+		label string
+	}{
+		{p.tally.passed, "passed"},
+		{p.tally.failed, "failed"},
+		{p.tally.timedOut, "timed out"},
+		{len(p.interrupted), "interrupted"},
+		{p.tally.cached, "cached"},
+		{p.tally.skipped, "skipped"},
+		{p.tally.cancelled, "cancelled"},
+		{p.tally.excluded, "excluded"},
+	}
+
+	var summary []string
+	for _, part := range parts {
+		if part.count > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", part.count, part.label))
+		}
+	}
+	if len(summary) == 0 {
+		return
+	}
+	fmt.Println(pterm.FgGray.Sprint(strings.Join(summary, ", ")))
+	if len(p.interrupted) > 0 {
+		pterm.FgYellow.Println("interrupted: " + strings.Join(p.interrupted, ", "))
+	}
+}
+
+// PrintOverlays lists what each local overlay changed, so results that
+// differ between machines can be traced back to uncommitted config.
+func PrintOverlays(overlays []domain.Overlay, root string) {
+	yellow := pterm.NewStyle(pterm.FgYellow)
+	for _, o := range overlays {
+		var changes []string
+		if len(o.Disabled) > 0 {
+			changes = append(changes, "disabled "+strings.Join(o.Disabled, ", "))
+		}
+		if len(o.Replaced) > 0 {
+			changes = append(changes, "replaced "+strings.Join(o.Replaced, ", "))
+		}
+		if len(o.Patched) > 0 {
+			changes = append(changes, "patched "+strings.Join(o.Patched, ", "))
+		}
+		if len(o.Added) > 0 {
+			changes = append(changes, "added "+strings.Join(o.Added, ", "))
+		}
+		if o.Jobs > 0 {
+			changes = append(changes, fmt.Sprintf("jobs %d", o.Jobs))
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		yellow.Printfln("local overlay %s: %s", relativeLabel(root, o.File), strings.Join(changes, "; "))
+	}
+}
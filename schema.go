@@ -0,0 +1,8 @@
+package qa
+
+import _ "embed"
+
+//go:generate go run ./cmd/schemagen -o qa.schema.json
+
+//go:embed qa.schema.json
+var SchemaContent string